@@ -0,0 +1,165 @@
+package gcache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// 请求签名时间戳的请求头，单位纳秒
+	timestampHeader = "X-Gcache-Timestamp"
+	// 请求签名随机数的请求头，时间窗口内每个随机数只能使用一次
+	nonceHeader = "X-Gcache-Nonce"
+	// 请求签名的请求头，十六进制编码的HMAC-SHA256
+	signatureHeader = "X-Gcache-Signature"
+	// 签名时间戳和服务端时间最多相差多久
+	defaultSignatureWindow = time.Minute
+)
+
+var (
+	errMissingSignature  = errors.New("missing signature")
+	errExpiredSignature  = errors.New("signature expired")
+	errInvalidSignature  = errors.New("invalid signature")
+	errReplayedSignature = errors.New("signature replayed")
+)
+
+// 使用共享密钥对节点之间的请求签名和验证
+// 使用第一个密钥签名，任意一个密钥验证通过即可，用于密钥轮换
+type signer struct {
+	mu      sync.RWMutex
+	secrets [][]byte
+	// 时间戳超出窗口的请求被拒绝，防止重放
+	window time.Duration
+
+	nonceMu sync.Mutex
+	// 已经使用的随机数，按照签名时间戳分桶
+	nonces [2]nonceBucket
+}
+
+// 签名时间戳在同一个长度为两个窗口的时间段内的随机数
+// 服务端接受的时间戳范围是两个窗口，最多跨越两个相邻的时间段，
+// 所以只需要保留两个桶，新的时间段直接替换较旧的桶，不需要逐个清理
+type nonceBucket struct {
+	// 时间段序号，时间戳除以两个窗口
+	index  int64
+	nonces map[string]struct{}
+}
+
+func newSigner(window time.Duration, secrets ...[]byte) *signer {
+	if window <= 0 {
+		window = defaultSignatureWindow
+	}
+	s := &signer{window: window}
+	s.setSecrets(secrets...)
+	return s
+}
+
+// 更新密钥
+func (s *signer) setSecrets(secrets ...[]byte) {
+	if len(secrets) == 0 {
+		panic("at least one secret is required")
+	}
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			panic("secret must not be empty")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets = secrets
+}
+
+// 对请求签名，body为请求体，s为nil时不签名
+// 超时时间请求头也会被签名，需要在设置之后调用
+func (s *signer) sign(req *http.Request, body []byte) {
+	if s == nil {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	nonce := hex.EncodeToString(b[:])
+	s.mu.RLock()
+	secret := s.secrets[0]
+	s.mu.RUnlock()
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(nonceHeader, nonce)
+	req.Header.Set(signatureHeader, hex.EncodeToString(signature(secret, req.Method, req.URL.RequestURI(),
+		timestamp, nonce, req.Header.Get(timeoutHeader), body)))
+}
+
+// 验证请求的签名，body为请求体
+// 签名正确但随机数在时间窗口内已经使用过的请求被拒绝
+func (s *signer) verify(r *http.Request, body []byte) error {
+	timestamp, nonce, sig := r.Header.Get(timestampHeader), r.Header.Get(nonceHeader), r.Header.Get(signatureHeader)
+	if timestamp == "" || nonce == "" || sig == "" {
+		return errMissingSignature
+	}
+	ns, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if d := time.Since(time.Unix(0, ns)); d > s.window || d < -s.window {
+		return errExpiredSignature
+	}
+	mac, err := hex.DecodeString(sig)
+	if err != nil {
+		return errInvalidSignature
+	}
+	s.mu.RLock()
+	secrets := s.secrets
+	s.mu.RUnlock()
+	for _, secret := range secrets {
+		if hmac.Equal(mac, signature(secret, r.Method, r.RequestURI, timestamp, nonce, r.Header.Get(timeoutHeader), body)) {
+			// 签名正确后才记录随机数，伪造的请求不会占用空间
+			return s.useNonce(nonce, ns)
+		}
+	}
+	return errInvalidSignature
+}
+
+// 记录随机数，时间戳还在窗口内时再次使用会被拒绝
+// ns为签名时间戳，随机数和时间戳一起被签名，重放的请求一定落在同一个桶
+func (s *signer) useNonce(nonce string, ns int64) error {
+	index := ns / int64(2*s.window)
+	s.nonceMu.Lock()
+	defer s.nonceMu.Unlock()
+	b := &s.nonces[0]
+	if b.index != index || b.nonces == nil {
+		if s.nonces[1].index == index && s.nonces[1].nonces != nil {
+			b = &s.nonces[1]
+		} else {
+			// 较旧的桶中的时间戳已经全部超出窗口
+			if s.nonces[1].index < b.index {
+				b = &s.nonces[1]
+			}
+			*b = nonceBucket{index: index, nonces: make(map[string]struct{})}
+		}
+	}
+	if _, ok := b.nonces[nonce]; ok {
+		return errReplayedSignature
+	}
+	b.nonces[nonce] = struct{}{}
+	return nil
+}
+
+// HMAC-SHA256(method \n path \n timestamp \n nonce \n timeout \n sha256(body))
+func signature(secret []byte, method, path, timestamp, nonce, timeout string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	for _, field := range []string{method, path, timestamp, nonce, timeout} {
+		mac.Write([]byte(field))
+		mac.Write([]byte{'\n'})
+	}
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,174 @@
+package gcache
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
+)
+
+func TestSigner(t *testing.T) {
+	s := newSigner(time.Minute, []byte("secret"))
+	body := []byte("body")
+	req := httptest.NewRequest(http.MethodPut, "/_gcache/group/key", nil)
+	s.sign(req, body)
+	if err := s.verify(req, body); err != nil {
+		t.Fatal(err)
+	}
+	// 重放同一个请求
+	if err := s.verify(req, body); err != errReplayedSignature {
+		t.Fatalf("replayed request should be rejected, err=%v", err)
+	}
+	if err := s.verify(req, []byte("other")); err != errInvalidSignature {
+		t.Fatalf("tampered body should be rejected, err=%v", err)
+	}
+	tampered := httptest.NewRequest(http.MethodDelete, "/_gcache/group/key", nil)
+	tampered.Header = req.Header
+	if err := s.verify(tampered, body); err != errInvalidSignature {
+		t.Fatalf("tampered method should be rejected, err=%v", err)
+	}
+	if err := newSigner(time.Minute, []byte("other")).verify(req, body); err != errInvalidSignature {
+		t.Fatalf("wrong secret should be rejected, err=%v", err)
+	}
+	if err := s.verify(httptest.NewRequest(http.MethodGet, "/", nil), nil); err != errMissingSignature {
+		t.Fatalf("unsigned request should be rejected, err=%v", err)
+	}
+	// 篡改超时时间
+	timed := httptest.NewRequest(http.MethodGet, "/_gcache/group/key", nil)
+	timed.Header.Set(timeoutHeader, "100")
+	s.sign(timed, nil)
+	timed.Header.Set(timeoutHeader, "100000")
+	if err := s.verify(timed, nil); err != errInvalidSignature {
+		t.Fatalf("tampered timeout should be rejected, err=%v", err)
+	}
+
+	// 超出时间窗口的请求
+	old := httptest.NewRequest(http.MethodGet, "/_gcache/group/key", nil)
+	timestamp := strconv.FormatInt(time.Now().Add(-2*time.Minute).UnixNano(), 10)
+	old.Header.Set(timestampHeader, timestamp)
+	old.Header.Set(nonceHeader, "nonce")
+	old.Header.Set(signatureHeader, hexSignature([]byte("secret"), old, timestamp, "nonce"))
+	if err := s.verify(old, nil); err != errExpiredSignature {
+		t.Fatalf("expired request should be rejected, err=%v", err)
+	}
+
+	// 轮换密钥，新旧密钥都可以验证
+	s.setSecrets([]byte("new"), []byte("secret"))
+	newSigner(time.Minute, []byte("secret")).sign(req, body)
+	if err := s.verify(req, body); err != nil {
+		t.Fatalf("previous secret should still be accepted, err=%v", err)
+	}
+	s.sign(req, body)
+	if err := newSigner(time.Minute, []byte("new")).verify(req, body); err != nil {
+		t.Fatalf("request should be signed with the first secret, err=%v", err)
+	}
+}
+
+func TestSigner_Nonces(t *testing.T) {
+	s := newSigner(time.Second, []byte("secret"))
+	period := int64(2 * time.Second)
+	base := time.Now().UnixNano() / period * period
+	if err := s.useNonce("a", base); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.useNonce("a", base+int64(time.Second)); err != errReplayedSignature {
+		t.Fatalf("replayed nonce should be rejected, err=%v", err)
+	}
+	// 相邻时间段使用另一个桶，旧桶保留
+	if err := s.useNonce("b", base+period); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.useNonce("a", base); err != errReplayedSignature {
+		t.Fatalf("nonce in previous bucket should be rejected, err=%v", err)
+	}
+	// 时间段再前进后整体丢弃最旧的桶
+	if err := s.useNonce("c", base+2*period); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range s.nonces {
+		if b.index == base/period {
+			t.Fatalf("oldest bucket should be dropped, buckets=%v", s.nonces)
+		}
+	}
+	if err := s.useNonce("b", base+period); err != errReplayedSignature {
+		t.Fatalf("nonce in live bucket should be rejected, err=%v", err)
+	}
+	// 没有数量上限
+	for i := 0; i < 1<<16; i++ {
+		if err := s.useNonce(strconv.Itoa(i), base+2*period); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func hexSignature(secret []byte, r *http.Request, timestamp, nonce string) string {
+	return hex.EncodeToString(signature(secret, r.Method, r.RequestURI, timestamp, nonce, "", nil))
+}
+
+func TestHTTPPool_Secrets(t *testing.T) {
+	g := NewGroup("http-secrets", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	server := NewHTTPPoolOpts("", &HTTPPoolOptions{Secrets: [][]byte{[]byte("old")}})
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	set := func(secrets ...[]byte) error {
+		opts := &HTTPPoolOptions{}
+		if len(secrets) > 0 {
+			opts.Secrets = secrets
+		}
+		pool := NewHTTPPoolOpts("self", opts)
+		pool.Set(srv.URL)
+		getter, _ := pool.PickPeer("key")
+		return getter.SetContext(context.Background(), &pb.SetRequest{Group: "http-secrets", Key: "key", Value: []byte("value")})
+	}
+	if err := set(); err == nil {
+		t.Fatalf("unsigned request should be rejected")
+	}
+	if err := set([]byte("wrong")); err == nil {
+		t.Fatalf("request with wrong secret should be rejected")
+	}
+	if _, ok := g.mainCache.get("key"); ok {
+		t.Fatalf("rejected request should not change cache")
+	}
+	if err := set([]byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务端加入新密钥后，新旧密钥签名的请求都能通过
+	server.SetSecrets([]byte("new"), []byte("old"))
+	if err := set([]byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := set([]byte("new"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	server.SetSecrets([]byte("new"))
+	if err := set([]byte("old")); err == nil {
+		t.Fatalf("request with removed secret should be rejected")
+	}
+
+	// 重放截获的请求
+	req, err := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"http-secrets/key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSigner(0, []byte("new")).sign(req, nil)
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		replay := req.Clone(context.Background())
+		res, err := http.DefaultClient.Do(replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("request %d status=%d, want %d", i, res.StatusCode, want)
+		}
+	}
+}
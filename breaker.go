@@ -0,0 +1,117 @@
+package gcache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// 连续失败多少次后熔断
+	defaultBreakerThreshold = 5
+	// 熔断后多久允许一次试探请求
+	defaultBreakerCooldown = 10 * time.Second
+)
+
+// 熔断器状态
+type breakerState int
+
+const (
+	// 正常
+	breakerClosed breakerState = iota
+	// 熔断，请求直接跳过该节点
+	breakerOpen
+	// 半开，只允许一次试探请求，成功后恢复，失败后重新熔断
+	breakerHalfOpen
+)
+
+// 远程节点的熔断器，为nil时总是允许请求
+type breaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// 是否允许请求，熔断超过cooldown后进入半开状态并允许一次请求
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.openedAt = time.Now()
+		return true
+	default:
+		// 已经有试探请求，试探请求没有结果时超过cooldown再允许一次
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.openedAt = time.Now()
+		return true
+	}
+}
+
+// 距离允许下一次请求的时间
+func (b *breaker) retryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerClosed {
+		return 0
+	}
+	if d := b.cooldown - time.Since(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// 请求成功，恢复正常
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// 请求失败，连续失败达到阈值或者试探失败时熔断
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// 是否正常
+func (b *breaker) healthy() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerClosed
+}
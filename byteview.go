@@ -1,11 +1,17 @@
 package gcache
 
-import "time"
+import (
+	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
+)
 
 // ByteView 一个不可变的字节数组视图
 type ByteView struct {
 	b      []byte
 	expire time.Time
+	// 缓存的空值，表示key不存在
+	notFound bool
 }
 
 func NewByteView(b []byte, expire time.Time) ByteView {
@@ -36,3 +42,37 @@ func cloneBytes(b []byte) []byte {
 	copy(c, b)
 	return c
 }
+
+// 过期时间转换为UnixNano，零值表示永不过期
+func toExpireNano(expire time.Time) int64 {
+	if expire.IsZero() {
+		return 0
+	}
+	return expire.UnixNano()
+}
+
+// UnixNano转换为过期时间，0表示永不过期
+func fromExpireNano(expireNano int64) time.Time {
+	if expireNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, expireNano)
+}
+
+// 转换为远程节点的响应
+func toResponse(v ByteView) *pb.Response {
+	return &pb.Response{
+		Value:    v.ByteSlice(),
+		Expire:   toExpireNano(v.expire),
+		NotFound: v.notFound,
+	}
+}
+
+// 从远程节点的响应转换
+func fromResponse(res *pb.Response) ByteView {
+	return ByteView{
+		b:        res.GetValue(),
+		expire:   fromExpireNano(res.GetExpire()),
+		notFound: res.GetNotFound(),
+	}
+}
@@ -1,43 +1,318 @@
 package gcache
 
 import (
+	policy "github.com/jiaxwu/gcache/cache"
 	"github.com/jiaxwu/gcache/lru"
 	"sync"
+	"time"
 )
 
+// Policy 创建缓存淘汰策略，每个缓存调用一次
+type Policy func() policy.Cache[string, ByteView]
+
+// LRU 最近最少使用淘汰策略
+func LRU() Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewLRU[string, ByteView]()
+	}
+}
+
+// LFU 最不经常使用淘汰策略
+func LFU() Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewLFU[string, ByteView]()
+	}
+}
+
+// FIFO 先进先出淘汰策略
+func FIFO() Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewFIFO[string, ByteView]()
+	}
+}
+
+// Random 随机淘汰策略
+func Random() Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewRandom[string, ByteView]()
+	}
+}
+
+// ApproxLRU 近似LRU淘汰策略，samples为每次淘汰的采样数量
+func ApproxLRU(samples int) Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewApproxLRU[string, ByteView](samples)
+	}
+}
+
+// Default 不淘汰，超过最大字节数时也不会删除数据
+func Default() Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewDefault[string, ByteView]()
+	}
+}
+
+// TinyLFU W-TinyLFU淘汰策略，capacity为预计最多缓存的元素个数
+func TinyLFU(capacity int) Policy {
+	return func() policy.Cache[string, ByteView] {
+		return policy.NewTinyLFU[string, ByteView](capacity)
+	}
+}
+
+// 缓存的存储结构
+type store interface {
+	Add(key string, value ByteView)
+	Get(key string) (ByteView, bool)
+	Remove(key string)
+	// 元素数量
+	Len() int
+	// 已经缓存的字节数
+	Bytes() int
+	// 淘汰的元素数量，包括过期的元素
+	Evictions() int64
+}
+
 // 并发安全的缓存操作
+// 分为多个分片，每个分片单独加锁，key根据哈希值选择分片，总字节数平均分给每个分片
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
 	cacheBytes int
+	// 淘汰策略，为nil时使用lru.Cache
+	policy Policy
+	// 分片数量，小于等于1时不分片
+	shards int
+	// 过期后继续保留的时间，存储时过期时间会加上grace，读取时再减去
+	grace time.Duration
+	// 后台清理过期键的间隔，为0表示不清理，只对lru.Cache生效
+	janitorInterval time.Duration
+
+	initOnce sync.Once
+	segments []*cacheSegment
+}
+
+// 缓存分片
+type cacheSegment struct {
+	mu    sync.Mutex
+	store store
+	// 关闭后不再启动后台清理
+	closed bool
+	// 统计信息，持有mu时更新，每个分片单独计数避免多核下争抢同一个计数器
+	nget int64
+	nhit int64
+	// 填充到缓存行，避免相邻分片的计数器伪共享
+	_ [64]byte
 }
 
 func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	s := c.segment(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		s.store = c.newStore(s)
+	}
+	if c.grace > 0 && !value.expire.IsZero() {
+		value.expire = value.expire.Add(c.grace)
 	}
-	c.lru.Add(key, value)
+	s.store.Add(key, value)
 }
 
-func (c *cache) get(key string) (ByteView, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+func (c *cache) get(key string) (value ByteView, ok bool) {
+	s := c.segment(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nget++
+	if s.store == nil {
 		return ByteView{}, false
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	value, ok = s.store.Get(key)
+	if !ok {
+		return ByteView{}, false
 	}
-	return ByteView{}, false
+	s.nhit++
+	if c.grace > 0 && !value.expire.IsZero() {
+		value.expire = value.expire.Add(-c.grace)
+	}
+	return value, ok
 }
 
 func (c *cache) remove(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	s := c.segment(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
 		return
 	}
-	c.lru.Remove(key)
+	s.store.Remove(key)
+}
+
+// 获取缓存的统计信息
+func (c *cache) stats() CacheStats {
+	c.segment("")
+	var stats CacheStats
+	for _, s := range c.segments {
+		s.mu.Lock()
+		stats.Gets += s.nget
+		stats.Hits += s.nhit
+		if s.store != nil {
+			stats.Evictions += s.store.Evictions()
+			stats.Bytes += int64(s.store.Bytes())
+			stats.Items += int64(s.store.Len())
+		}
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// 停止所有分片的后台清理，关闭后仍然可以读写
+func (c *cache) close() {
+	c.segment("")
+	for _, s := range c.segments {
+		s.mu.Lock()
+		s.closed = true
+		store := s.store
+		s.mu.Unlock()
+		// 清理时会持有分片的锁，需要在锁外等待退出
+		if store, ok := store.(*lruStore); ok {
+			store.StopJanitor()
+		}
+	}
+}
+
+// 获取key所在的分片
+func (c *cache) segment(key string) *cacheSegment {
+	c.initOnce.Do(func() {
+		n := c.shards
+		if n < 1 {
+			n = 1
+		}
+		c.segments = make([]*cacheSegment, n)
+		for i := range c.segments {
+			c.segments[i] = &cacheSegment{}
+		}
+	})
+	if len(c.segments) == 1 {
+		return c.segments[0]
+	}
+	return c.segments[fnv32a(key)%uint32(len(c.segments))]
+}
+
+// FNV-1a哈希
+func fnv32a(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// 创建分片的存储结构
+func (c *cache) newStore(segment *cacheSegment) store {
+	maxBytes := c.cacheBytes
+	if n := len(c.segments); n > 1 && maxBytes > 0 {
+		maxBytes /= n
+		if maxBytes == 0 {
+			maxBytes = 1
+		}
+	}
+	if c.policy == nil {
+		s := &lruStore{}
+		s.Cache = lru.New(maxBytes, func(string, lru.Value) {
+			// 主动删除不算淘汰
+			if !s.removing {
+				s.evictions++
+			}
+		})
+		if c.janitorInterval > 0 && !segment.closed {
+			// 每次清理最多占用四分之一的时间
+			s.StartJanitor(&segment.mu, c.janitorInterval, c.janitorInterval/4)
+		}
+		return s
+	}
+	return &policyStore{cache: c.policy(), maxBytes: maxBytes}
+}
+
+// 使用lru.Cache存储
+type lruStore struct {
+	*lru.Cache
+	// 是否正在主动删除
+	removing  bool
+	evictions int64
+}
+
+func (s *lruStore) Add(key string, value ByteView) {
+	s.Cache.Add(key, value)
+}
+
+func (s *lruStore) Get(key string) (ByteView, bool) {
+	if v, ok := s.Cache.Get(key); ok {
+		return v.(ByteView), true
+	}
+	return ByteView{}, false
+}
+
+func (s *lruStore) Remove(key string) {
+	s.removing = true
+	s.Cache.Remove(key)
+	s.removing = false
+}
+
+func (s *lruStore) Evictions() int64 {
+	return s.evictions
+}
+
+// 使用淘汰策略存储，按照字节数淘汰，过期的键在访问时删除
+type policyStore struct {
+	cache policy.Cache[string, ByteView]
+	// 最大缓存字节数，为0表示不限制
+	maxBytes int
+	// 已经缓存字节数
+	nBytes    int
+	evictions int64
+}
+
+func (s *policyStore) Add(key string, value ByteView) {
+	if orig, ok := s.cache.Set(key, value); ok {
+		s.nBytes += value.Len() - orig.Len()
+	} else {
+		s.nBytes += len(key) + value.Len()
+	}
+	for s.maxBytes != 0 && s.nBytes > s.maxBytes {
+		evictedKey, evictedVal, ok := s.cache.Evict()
+		if !ok {
+			break
+		}
+		s.nBytes -= len(evictedKey) + evictedVal.Len()
+		s.evictions++
+	}
+}
+
+func (s *policyStore) Get(key string) (ByteView, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	if !value.Expire().IsZero() && value.Expire().Before(time.Now()) {
+		s.Remove(key)
+		s.evictions++
+		return ByteView{}, false
+	}
+	return value, true
+}
+
+func (s *policyStore) Remove(key string) {
+	if orig, ok := s.cache.Del(key); ok {
+		s.nBytes -= len(key) + orig.Len()
+	}
+}
+
+func (s *policyStore) Len() int {
+	return s.cache.Len()
+}
+
+func (s *policyStore) Bytes() int {
+	return s.nBytes
+}
+
+func (s *policyStore) Evictions() int64 {
+	return s.evictions
 }
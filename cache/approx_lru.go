@@ -2,3 +2,133 @@ package cache
 
 // 近似LRU
 // https://github.com/redis/redis/blob/unstable/src/evict.c
+
+const (
+	// 默认每次淘汰采样的元素个数
+	defaultApproxLRUSamples = 5
+	// 淘汰池大小
+	evictionPoolSize = 16
+)
+
+// ApproxLRU 近似LRU，淘汰时随机采样一些元素，淘汰其中最久没有被访问的元素
+// 和Redis一样使用淘汰池保存历次采样中最久没有被访问的元素，提高近似程度
+type ApproxLRU[K comparable, V any] struct {
+	entries *randomEntries[K, V]
+	// 每次淘汰采样的元素个数
+	samples int
+	// 逻辑时钟，每次访问加一
+	clock uint64
+	// 淘汰池，按照最后访问时间从早到晚排列
+	pool []evictionCandidate[K]
+}
+
+// 淘汰池里面的候选元素
+type evictionCandidate[K comparable] struct {
+	key K
+	// 采样时元素的最后访问时间
+	clock uint64
+}
+
+// NewApproxLRU 创建近似LRU，samples为每次淘汰采样的元素个数，小于等于0时使用默认值
+func NewApproxLRU[K comparable, V any](samples int) *ApproxLRU[K, V] {
+	if samples <= 0 {
+		samples = defaultApproxLRUSamples
+	}
+	return &ApproxLRU[K, V]{
+		entries: newRandomEntries[K, V](),
+		samples: samples,
+	}
+}
+
+func (c *ApproxLRU[K, V]) Get(key K) (val V, exist bool) {
+	ent, ok := c.entries.get(key)
+	if !ok {
+		return val, false
+	}
+	c.touch(ent)
+	return ent.val, true
+}
+
+func (c *ApproxLRU[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if ent, ok := c.entries.get(key); ok {
+		origVal, ent.val = ent.val, val
+		c.touch(ent)
+		return origVal, true
+	}
+	ent := &randomEntry[K, V]{key: key, val: val}
+	c.touch(ent)
+	c.entries.add(ent)
+	return origVal, false
+}
+
+func (c *ApproxLRU[K, V]) Del(key K) (origVal V, origExist bool) {
+	ent, ok := c.entries.get(key)
+	if !ok {
+		return origVal, false
+	}
+	c.entries.remove(ent)
+	return ent.val, true
+}
+
+func (c *ApproxLRU[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	if c.entries.len() == 0 {
+		return evictedKey, evictedVal, false
+	}
+	c.populatePool()
+	for len(c.pool) > 0 {
+		candidate := c.pool[0]
+		c.pool = append(c.pool[:0], c.pool[1:]...)
+		// 候选元素已经被删除或者采样之后被访问过
+		ent, ok := c.entries.get(candidate.key)
+		if !ok || ent.clock != candidate.clock {
+			continue
+		}
+		c.entries.remove(ent)
+		return ent.key, ent.val, true
+	}
+	// 淘汰池里面都是失效的元素，随机淘汰一个
+	ent := c.entries.random()
+	c.entries.remove(ent)
+	return ent.key, ent.val, true
+}
+
+func (c *ApproxLRU[K, V]) Len() int {
+	return c.entries.len()
+}
+
+// 更新最后访问时间
+func (c *ApproxLRU[K, V]) touch(ent *randomEntry[K, V]) {
+	c.clock++
+	ent.clock = c.clock
+}
+
+// 随机采样元素放入淘汰池
+func (c *ApproxLRU[K, V]) populatePool() {
+	for i := 0; i < c.samples; i++ {
+		ent := c.entries.random()
+		c.insertPool(evictionCandidate[K]{key: ent.key, clock: ent.clock})
+	}
+}
+
+// 按照最后访问时间插入淘汰池，池满时丢弃最近访问的元素
+func (c *ApproxLRU[K, V]) insertPool(candidate evictionCandidate[K]) {
+	for i, exist := range c.pool {
+		if exist.key == candidate.key {
+			c.pool = append(c.pool[:i], c.pool[i+1:]...)
+			break
+		}
+	}
+	i := 0
+	for i < len(c.pool) && c.pool[i].clock <= candidate.clock {
+		i++
+	}
+	if i >= evictionPoolSize {
+		return
+	}
+	c.pool = append(c.pool, evictionCandidate[K]{})
+	copy(c.pool[i+1:], c.pool[i:])
+	c.pool[i] = candidate
+	if len(c.pool) > evictionPoolSize {
+		c.pool = c.pool[:evictionPoolSize]
+	}
+}
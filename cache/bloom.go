@@ -0,0 +1,59 @@
+package cache
+
+// 布隆过滤器，作为TinyLFU的doorkeeper过滤只访问过一次的key
+
+const (
+	// 哈希函数个数
+	bloomHashes = 3
+	// 每个元素占用的位数
+	bloomBitsPerItem = 8
+)
+
+type bloomFilter struct {
+	bits []uint64
+	mask uint64
+}
+
+// n为预计元素个数
+func newBloomFilter(n int) *bloomFilter {
+	nbits := nextPowerOfTwo(n * bloomBitsPerItem)
+	if nbits < 64 {
+		nbits = 64
+	}
+	return &bloomFilter{
+		bits: make([]uint64, nbits/64),
+		mask: uint64(nbits - 1),
+	}
+}
+
+// 添加元素，返回元素之前是否可能存在
+func (b *bloomFilter) add(h uint64) bool {
+	exist := true
+	h1, h2 := h, h>>32|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & b.mask
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			exist = false
+			b.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return exist
+}
+
+// 判断元素是否可能存在
+func (b *bloomFilter) contains(h uint64) bool {
+	h1, h2 := h, h>>32|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & b.mask
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
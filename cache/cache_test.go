@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+// 所有Cache实现都需要通过的测试
+// evicts为false表示该实现不会淘汰元素
+func testCache(t *testing.T, newCache func() Cache[string, int], evicts bool) {
+	t.Run("GetSetDel", func(t *testing.T) {
+		c := newCache()
+		if _, ok := c.Get("a"); ok {
+			t.Fatalf("get missing key should fail")
+		}
+		if orig, ok := c.Set("a", 1); ok || orig != 0 {
+			t.Fatalf("set new key returned orig=%v exist=%v", orig, ok)
+		}
+		if orig, ok := c.Set("a", 2); !ok || orig != 1 {
+			t.Fatalf("set exist key returned orig=%v exist=%v", orig, ok)
+		}
+		if val, ok := c.Get("a"); !ok || val != 2 {
+			t.Fatalf("get a=%v exist=%v, want 2", val, ok)
+		}
+		c.Set("b", 3)
+		if c.Len() != 2 {
+			t.Fatalf("len=%d, want 2", c.Len())
+		}
+		if orig, ok := c.Del("a"); !ok || orig != 2 {
+			t.Fatalf("del returned orig=%v exist=%v", orig, ok)
+		}
+		if _, ok := c.Del("a"); ok {
+			t.Fatalf("del missing key should fail")
+		}
+		if _, ok := c.Get("a"); ok || c.Len() != 1 {
+			t.Fatalf("deleted key still exists, len=%d", c.Len())
+		}
+		if val, ok := c.Get("b"); !ok || val != 3 {
+			t.Fatalf("get b=%v exist=%v, want 3", val, ok)
+		}
+	})
+
+	t.Run("Evict", func(t *testing.T) {
+		c := newCache()
+		if _, _, ok := c.Evict(); ok {
+			t.Fatalf("evict empty cache should fail")
+		}
+		n := 100
+		for i := 0; i < n; i++ {
+			c.Set(strconv.Itoa(i), i)
+		}
+		// 穿插访问和删除
+		for i := 0; i < n; i += 3 {
+			c.Get(strconv.Itoa(i))
+		}
+		for i := 0; i < n; i += 10 {
+			c.Del(strconv.Itoa(i))
+		}
+		remain := c.Len()
+		if !evicts {
+			if _, _, ok := c.Evict(); ok || c.Len() != remain {
+				t.Fatalf("cache should not evict")
+			}
+			return
+		}
+		evicted := make(map[string]bool)
+		for c.Len() > 0 {
+			key, val, ok := c.Evict()
+			if !ok {
+				t.Fatalf("evict failed, len=%d", c.Len())
+			}
+			i, _ := strconv.Atoi(key)
+			if evicted[key] || i%10 == 0 || val != i {
+				t.Fatalf("evicted unexpected %s=%d", key, val)
+			}
+			evicted[key] = true
+			if _, ok := c.Get(key); ok {
+				t.Fatalf("evicted key %s still exists", key)
+			}
+		}
+		if len(evicted) != remain {
+			t.Fatalf("evicted %d keys, want %d", len(evicted), remain)
+		}
+		if _, _, ok := c.Evict(); ok {
+			t.Fatalf("evict empty cache should fail")
+		}
+	})
+}
+
+// 检查淘汰顺序
+func testEvictOrder(t *testing.T, c Cache[string, int], want ...string) {
+	for _, key := range want {
+		if evictedKey, _, ok := c.Evict(); !ok || evictedKey != key {
+			t.Fatalf("evicted %s, want %s", evictedKey, key)
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewLRU[string, int]() }, true)
+
+	c := NewLRU[string, int]()
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("b", 4)
+	testEvictOrder(t, c, "c", "a", "b")
+}
+
+func TestFIFO(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewFIFO[string, int]() }, true)
+
+	c := NewFIFO[string, int]()
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("b", 4)
+	testEvictOrder(t, c, "a", "b", "c")
+}
+
+func TestLFU(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewLFU[string, int]() }, true)
+
+	c := NewLFU[string, int]()
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Set("c", 4)
+	c.Set("d", 5)
+	testEvictOrder(t, c, "d", "b", "c", "a")
+}
+
+func TestRandom(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewRandom[string, int]() }, true)
+}
+
+func TestApproxLRU(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewApproxLRU[string, int](0) }, true)
+
+	// 采样数量足够多时和LRU一致
+	c := NewApproxLRU[string, int](100)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("b", 4)
+	testEvictOrder(t, c, "c", "a", "b")
+}
+
+func TestDefault(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewDefault[string, int]() }, false)
+}
+
+func TestTinyLFU(t *testing.T) {
+	testCache(t, func() Cache[string, int] { return NewTinyLFU[string, int](100) }, true)
+
+	// 频繁访问的key不会被一次性扫描淘汰
+	capacity := 100
+	c := NewTinyLFU[string, int](capacity)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < capacity/2; i++ {
+			key := "hot" + strconv.Itoa(i)
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, i)
+			}
+			for c.Len() > capacity {
+				c.Evict()
+			}
+		}
+	}
+	for i := 0; i < capacity*10; i++ {
+		c.Set("scan"+strconv.Itoa(i), i)
+		for c.Len() > capacity {
+			c.Evict()
+		}
+	}
+	for i := 0; i < capacity/2; i++ {
+		if _, ok := c.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot key %d evicted by scan", i)
+		}
+	}
+}
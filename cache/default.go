@@ -1,3 +1,39 @@
 package cache
 
 // 默认策略不淘汰元素
+
+// Default 不淘汰任何元素，Evict总是返回false
+type Default[K comparable, V any] struct {
+	cache map[K]V
+}
+
+func NewDefault[K comparable, V any]() *Default[K, V] {
+	return &Default[K, V]{
+		cache: make(map[K]V),
+	}
+}
+
+func (c *Default[K, V]) Get(key K) (val V, exist bool) {
+	val, exist = c.cache[key]
+	return val, exist
+}
+
+func (c *Default[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	origVal, origExist = c.cache[key]
+	c.cache[key] = val
+	return origVal, origExist
+}
+
+func (c *Default[K, V]) Del(key K) (origVal V, origExist bool) {
+	origVal, origExist = c.cache[key]
+	delete(c.cache, key)
+	return origVal, origExist
+}
+
+func (c *Default[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	return evictedKey, evictedVal, false
+}
+
+func (c *Default[K, V]) Len() int {
+	return len(c.cache)
+}
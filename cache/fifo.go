@@ -1 +1,63 @@
 package cache
+
+import "container/list"
+
+// FIFO 淘汰最早加入的元素，访问和更新不会改变淘汰顺序
+type FIFO[K comparable, V any] struct {
+	// 队头是最早加入的元素
+	ll    *list.List
+	cache map[K]*list.Element
+}
+
+func NewFIFO[K comparable, V any]() *FIFO[K, V] {
+	return &FIFO[K, V]{
+		ll:    list.New(),
+		cache: make(map[K]*list.Element),
+	}
+}
+
+func (c *FIFO[K, V]) Get(key K) (val V, exist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		return val, false
+	}
+	return element.Value.(*entry[K, V]).val, true
+}
+
+func (c *FIFO[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if element, ok := c.cache[key]; ok {
+		ent := element.Value.(*entry[K, V])
+		origVal, ent.val = ent.val, val
+		return origVal, true
+	}
+	c.cache[key] = c.ll.PushBack(&entry[K, V]{key: key, val: val})
+	return origVal, false
+}
+
+func (c *FIFO[K, V]) Del(key K) (origVal V, origExist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		return origVal, false
+	}
+	c.removeElement(element)
+	return element.Value.(*entry[K, V]).val, true
+}
+
+func (c *FIFO[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	front := c.ll.Front()
+	if front == nil {
+		return evictedKey, evictedVal, false
+	}
+	c.removeElement(front)
+	ent := front.Value.(*entry[K, V])
+	return ent.key, ent.val, true
+}
+
+func (c *FIFO[K, V]) Len() int {
+	return c.ll.Len()
+}
+
+func (c *FIFO[K, V]) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.cache, e.Value.(*entry[K, V]).key)
+}
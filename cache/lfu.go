@@ -1,3 +1,109 @@
 package cache
 
-// https://github.com/redis/redis/blob/unstable/src/evict.c
+import "container/list"
+
+// O(1)的LFU实现
+// http://dhruvbird.com/lfu.pdf
+
+// LFU 淘汰访问次数最少的元素，访问次数相同时淘汰最早访问的元素
+type LFU[K comparable, V any] struct {
+	// 按照访问次数从小到大排列的频率节点
+	freqs *list.List
+	cache map[K]*lfuEntry[K, V]
+}
+
+// 频率节点，items里面是访问次数为freq的元素，队头是最早访问的元素
+type freqNode struct {
+	freq  int
+	items *list.List
+}
+
+type lfuEntry[K comparable, V any] struct {
+	key K
+	val V
+	// 所属的频率节点
+	freqElement *list.Element
+	// 在频率节点items里面的位置
+	element *list.Element
+}
+
+func NewLFU[K comparable, V any]() *LFU[K, V] {
+	return &LFU[K, V]{
+		freqs: list.New(),
+		cache: make(map[K]*lfuEntry[K, V]),
+	}
+}
+
+func (c *LFU[K, V]) Get(key K) (val V, exist bool) {
+	ent, ok := c.cache[key]
+	if !ok {
+		return val, false
+	}
+	c.increment(ent)
+	return ent.val, true
+}
+
+func (c *LFU[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if ent, ok := c.cache[key]; ok {
+		origVal, ent.val = ent.val, val
+		c.increment(ent)
+		return origVal, true
+	}
+	// 新元素访问次数为1
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*freqNode).freq != 1 {
+		front = c.freqs.PushFront(&freqNode{freq: 1, items: list.New()})
+	}
+	ent := &lfuEntry[K, V]{key: key, val: val, freqElement: front}
+	ent.element = front.Value.(*freqNode).items.PushBack(ent)
+	c.cache[key] = ent
+	return origVal, false
+}
+
+func (c *LFU[K, V]) Del(key K) (origVal V, origExist bool) {
+	ent, ok := c.cache[key]
+	if !ok {
+		return origVal, false
+	}
+	c.removeEntry(ent)
+	return ent.val, true
+}
+
+func (c *LFU[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	front := c.freqs.Front()
+	if front == nil {
+		return evictedKey, evictedVal, false
+	}
+	ent := front.Value.(*freqNode).items.Front().Value.(*lfuEntry[K, V])
+	c.removeEntry(ent)
+	return ent.key, ent.val, true
+}
+
+func (c *LFU[K, V]) Len() int {
+	return len(c.cache)
+}
+
+// 增加访问次数，移动到下一个频率节点
+func (c *LFU[K, V]) increment(ent *lfuEntry[K, V]) {
+	cur := ent.freqElement
+	curNode := cur.Value.(*freqNode)
+	next := cur.Next()
+	if next == nil || next.Value.(*freqNode).freq != curNode.freq+1 {
+		next = c.freqs.InsertAfter(&freqNode{freq: curNode.freq + 1, items: list.New()}, cur)
+	}
+	curNode.items.Remove(ent.element)
+	if curNode.items.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+	ent.freqElement = next
+	ent.element = next.Value.(*freqNode).items.PushBack(ent)
+}
+
+func (c *LFU[K, V]) removeEntry(ent *lfuEntry[K, V]) {
+	node := ent.freqElement.Value.(*freqNode)
+	node.items.Remove(ent.element)
+	if node.items.Len() == 0 {
+		c.freqs.Remove(ent.freqElement)
+	}
+	delete(c.cache, ent.key)
+}
@@ -1 +1,70 @@
 package cache
+
+import "container/list"
+
+// LRU 淘汰最近最少使用的元素
+type LRU[K comparable, V any] struct {
+	// 队头是最近最少使用的元素
+	ll    *list.List
+	cache map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key K
+	val V
+}
+
+func NewLRU[K comparable, V any]() *LRU[K, V] {
+	return &LRU[K, V]{
+		ll:    list.New(),
+		cache: make(map[K]*list.Element),
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (val V, exist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		return val, false
+	}
+	c.ll.MoveToBack(element)
+	return element.Value.(*entry[K, V]).val, true
+}
+
+func (c *LRU[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if element, ok := c.cache[key]; ok {
+		c.ll.MoveToBack(element)
+		ent := element.Value.(*entry[K, V])
+		origVal, ent.val = ent.val, val
+		return origVal, true
+	}
+	c.cache[key] = c.ll.PushBack(&entry[K, V]{key: key, val: val})
+	return origVal, false
+}
+
+func (c *LRU[K, V]) Del(key K) (origVal V, origExist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		return origVal, false
+	}
+	c.removeElement(element)
+	return element.Value.(*entry[K, V]).val, true
+}
+
+func (c *LRU[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	front := c.ll.Front()
+	if front == nil {
+		return evictedKey, evictedVal, false
+	}
+	c.removeElement(front)
+	ent := front.Value.(*entry[K, V])
+	return ent.key, ent.val, true
+}
+
+func (c *LRU[K, V]) Len() int {
+	return c.ll.Len()
+}
+
+func (c *LRU[K, V]) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.cache, e.Value.(*entry[K, V]).key)
+}
@@ -1 +1,108 @@
 package cache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Random 随机淘汰元素
+type Random[K comparable, V any] struct {
+	entries *randomEntries[K, V]
+}
+
+func NewRandom[K comparable, V any]() *Random[K, V] {
+	return &Random[K, V]{
+		entries: newRandomEntries[K, V](),
+	}
+}
+
+func (c *Random[K, V]) Get(key K) (val V, exist bool) {
+	ent, ok := c.entries.get(key)
+	if !ok {
+		return val, false
+	}
+	return ent.val, true
+}
+
+func (c *Random[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if ent, ok := c.entries.get(key); ok {
+		origVal, ent.val = ent.val, val
+		return origVal, true
+	}
+	c.entries.add(&randomEntry[K, V]{key: key, val: val})
+	return origVal, false
+}
+
+func (c *Random[K, V]) Del(key K) (origVal V, origExist bool) {
+	ent, ok := c.entries.get(key)
+	if !ok {
+		return origVal, false
+	}
+	c.entries.remove(ent)
+	return ent.val, true
+}
+
+func (c *Random[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	if c.entries.len() == 0 {
+		return evictedKey, evictedVal, false
+	}
+	ent := c.entries.random()
+	c.entries.remove(ent)
+	return ent.key, ent.val, true
+}
+
+func (c *Random[K, V]) Len() int {
+	return c.entries.len()
+}
+
+type randomEntry[K comparable, V any] struct {
+	key K
+	val V
+	// 在randomEntries.list里面的下标
+	index int
+	// 最后一次访问的逻辑时钟，近似LRU使用
+	clock uint64
+}
+
+// 支持O(1)随机获取元素的集合
+type randomEntries[K comparable, V any] struct {
+	list  []*randomEntry[K, V]
+	cache map[K]*randomEntry[K, V]
+	rand  *rand.Rand
+}
+
+func newRandomEntries[K comparable, V any]() *randomEntries[K, V] {
+	return &randomEntries[K, V]{
+		cache: make(map[K]*randomEntry[K, V]),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (e *randomEntries[K, V]) get(key K) (*randomEntry[K, V], bool) {
+	ent, ok := e.cache[key]
+	return ent, ok
+}
+
+func (e *randomEntries[K, V]) add(ent *randomEntry[K, V]) {
+	ent.index = len(e.list)
+	e.list = append(e.list, ent)
+	e.cache[ent.key] = ent
+}
+
+// 把最后一个元素移动到被删除元素的位置
+func (e *randomEntries[K, V]) remove(ent *randomEntry[K, V]) {
+	last := e.list[len(e.list)-1]
+	e.list[ent.index] = last
+	last.index = ent.index
+	e.list[len(e.list)-1] = nil
+	e.list = e.list[:len(e.list)-1]
+	delete(e.cache, ent.key)
+}
+
+func (e *randomEntries[K, V]) random() *randomEntry[K, V] {
+	return e.list[e.rand.Intn(len(e.list))]
+}
+
+func (e *randomEntries[K, V]) len() int {
+	return len(e.list)
+}
@@ -0,0 +1,62 @@
+package cache
+
+// Count-Min Sketch，用于近似统计key的访问频率
+// https://en.wikipedia.org/wiki/Count%E2%80%93min_sketch
+
+const (
+	// 行数，每行使用不同的哈希函数
+	sketchDepth = 4
+	// 计数器最大值，和4位计数器一样
+	sketchMaxCount = 15
+)
+
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+type countMinSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+}
+
+// width为每行的计数器个数，会向上取整为2的幂
+func newCountMinSketch(width int) *countMinSketch {
+	width = nextPowerOfTwo(width)
+	s := &countMinSketch{mask: uint64(width - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// 增加计数
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+}
+
+// 估计访问次数，取所有行的最小值
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	min := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if count := s.rows[i][s.index(h, i)]; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// 所有计数减半，让过去的访问频率逐渐失效
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+func (s *countMinSketch) index(h uint64, i int) uint64 {
+	return mix64(h^sketchSeeds[i]) & s.mask
+}
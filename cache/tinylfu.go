@@ -0,0 +1,210 @@
+package cache
+
+import "container/list"
+
+// W-TinyLFU
+// https://arxiv.org/abs/1512.00727
+// https://github.com/ben-manes/caffeine/wiki/Efficiency
+
+const (
+	// 窗口LRU占缓存元素的百分比
+	tinyLFUWindowPercent = 1
+	// 受保护区占主缓存元素的百分比
+	tinyLFUProtectedPercent = 80
+	// 访问次数达到容量的多少倍时频率减半
+	tinyLFUSampleFactor = 10
+)
+
+// 元素所在的区域
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// TinyLFU W-TinyLFU淘汰策略
+// 新元素先进入窗口LRU，淘汰时窗口中最久未访问的元素和主缓存试用区最久未访问的元素比较访问频率，
+// 频率低的被淘汰，频率高的留在主缓存。主缓存是分段LRU，试用区中再次被访问的元素晋升到受保护区
+// 访问频率使用Count-Min Sketch统计，并使用布隆过滤器过滤只访问过一次的key，访问次数达到阈值后频率减半
+type TinyLFU[K comparable, V any] struct {
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	cache     map[K]*list.Element
+
+	sketch     *countMinSketch
+	doorkeeper *bloomFilter
+	// 频率减半前已经记录的访问次数
+	additions int
+	// 访问次数达到该值时频率减半
+	sampleSize int
+}
+
+type tinyLFUEntry[K comparable, V any] struct {
+	key     K
+	val     V
+	hash    uint64
+	segment int
+}
+
+// NewTinyLFU 创建W-TinyLFU，capacity为预计最多缓存的元素个数，用于确定频率统计的大小和减半周期
+func NewTinyLFU[K comparable, V any](capacity int) *TinyLFU[K, V] {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	// 两次频率减半之间最多有sampleSize个不同的key
+	sampleSize := tinyLFUSampleFactor * capacity
+	return &TinyLFU[K, V]{
+		window:     list.New(),
+		probation:  list.New(),
+		protected:  list.New(),
+		cache:      make(map[K]*list.Element),
+		sketch:     newCountMinSketch(sampleSize),
+		doorkeeper: newBloomFilter(sampleSize),
+		sampleSize: sampleSize,
+	}
+}
+
+func (c *TinyLFU[K, V]) Get(key K) (val V, exist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		// 未命中也需要记录访问频率
+		c.record(hashKey(key))
+		return val, false
+	}
+	ent := element.Value.(*tinyLFUEntry[K, V])
+	c.record(ent.hash)
+	c.access(element)
+	return ent.val, true
+}
+
+func (c *TinyLFU[K, V]) Set(key K, val V) (origVal V, origExist bool) {
+	if element, ok := c.cache[key]; ok {
+		ent := element.Value.(*tinyLFUEntry[K, V])
+		origVal, ent.val = ent.val, val
+		c.record(ent.hash)
+		c.access(element)
+		return origVal, true
+	}
+	ent := &tinyLFUEntry[K, V]{key: key, val: val, hash: hashKey(key), segment: segmentWindow}
+	c.record(ent.hash)
+	c.cache[key] = c.window.PushBack(ent)
+	return origVal, false
+}
+
+func (c *TinyLFU[K, V]) Del(key K) (origVal V, origExist bool) {
+	element, ok := c.cache[key]
+	if !ok {
+		return origVal, false
+	}
+	c.removeElement(element)
+	return element.Value.(*tinyLFUEntry[K, V]).val, true
+}
+
+func (c *TinyLFU[K, V]) Evict() (evictedKey K, evictedVal V, evicted bool) {
+	if len(c.cache) == 0 {
+		return evictedKey, evictedVal, false
+	}
+	// 缓存第一次满之前窗口会超出目标大小，超出的部分直接进入主缓存
+	target := c.windowTarget()
+	for c.window.Len() > target+1 {
+		c.moveTo(c.window.Front(), segmentProbation)
+	}
+	victim := c.victim()
+	if c.window.Len() > target || victim == nil {
+		// 窗口中最久未访问的元素和主缓存的淘汰者竞争
+		candidate := c.window.Front()
+		if victim != nil && c.frequency(candidate) > c.frequency(victim) {
+			c.moveTo(candidate, segmentProbation)
+		} else {
+			victim = candidate
+		}
+	}
+	c.removeElement(victim)
+	ent := victim.Value.(*tinyLFUEntry[K, V])
+	return ent.key, ent.val, true
+}
+
+func (c *TinyLFU[K, V]) Len() int {
+	return len(c.cache)
+}
+
+// 主缓存的淘汰者，优先淘汰试用区
+func (c *TinyLFU[K, V]) victim() *list.Element {
+	if victim := c.probation.Front(); victim != nil {
+		return victim
+	}
+	return c.protected.Front()
+}
+
+// 访问元素，试用区的元素晋升到受保护区
+func (c *TinyLFU[K, V]) access(element *list.Element) {
+	switch element.Value.(*tinyLFUEntry[K, V]).segment {
+	case segmentWindow:
+		c.window.MoveToBack(element)
+	case segmentProbation:
+		c.moveTo(element, segmentProtected)
+		// 受保护区超出目标大小时降级到试用区
+		target := (len(c.cache) - c.window.Len()) * tinyLFUProtectedPercent / 100
+		for c.protected.Len() > target && c.protected.Len() > 1 {
+			c.moveTo(c.protected.Front(), segmentProbation)
+		}
+	case segmentProtected:
+		c.protected.MoveToBack(element)
+	}
+}
+
+// 把元素移动到segment的队尾
+func (c *TinyLFU[K, V]) moveTo(element *list.Element, segment int) {
+	ent := c.segmentList(element).Remove(element).(*tinyLFUEntry[K, V])
+	ent.segment = segment
+	c.cache[ent.key] = c.segmentList(element).PushBack(ent)
+}
+
+func (c *TinyLFU[K, V]) removeElement(element *list.Element) {
+	ent := c.segmentList(element).Remove(element).(*tinyLFUEntry[K, V])
+	delete(c.cache, ent.key)
+}
+
+func (c *TinyLFU[K, V]) segmentList(element *list.Element) *list.List {
+	switch element.Value.(*tinyLFUEntry[K, V]).segment {
+	case segmentWindow:
+		return c.window
+	case segmentProbation:
+		return c.probation
+	default:
+		return c.protected
+	}
+}
+
+// 窗口的目标大小
+func (c *TinyLFU[K, V]) windowTarget() int {
+	target := len(c.cache) * tinyLFUWindowPercent / 100
+	if target < 1 {
+		target = 1
+	}
+	return target
+}
+
+// 记录一次访问，第一次访问只记录在doorkeeper中
+func (c *TinyLFU[K, V]) record(h uint64) {
+	if c.doorkeeper.add(h) {
+		c.sketch.increment(h)
+	}
+	c.additions++
+	if c.additions >= c.sampleSize {
+		c.sketch.reset()
+		c.doorkeeper.reset()
+		c.additions /= 2
+	}
+}
+
+// 估计元素的访问频率
+func (c *TinyLFU[K, V]) frequency(element *list.Element) int {
+	h := element.Value.(*tinyLFUEntry[K, V]).hash
+	freq := int(c.sketch.estimate(h))
+	if c.doorkeeper.contains(h) {
+		freq++
+	}
+	return freq
+}
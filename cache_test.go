@@ -0,0 +1,191 @@
+package gcache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	policy "github.com/jiaxwu/gcache/cache"
+)
+
+func TestCache_Policy(t *testing.T) {
+	c := &cache{cacheBytes: 100, policy: TinyLFU(10)}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, NewByteView([]byte(key), time.Time{}))
+	}
+	s := c.segments[0].store.(*policyStore)
+	if s.nBytes > c.cacheBytes {
+		t.Fatalf("cache bytes %d exceed %d", s.nBytes, c.cacheBytes)
+	}
+	var n, nBytes int
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := c.get(key); ok {
+			if v.String() != key {
+				t.Fatalf("get %s=%s", key, v.String())
+			}
+			n++
+			nBytes += len(key) * 2
+		}
+	}
+	if n == 0 || nBytes != s.nBytes {
+		t.Fatalf("cached %d keys with %d bytes, store counted %d bytes", n, nBytes, s.nBytes)
+	}
+
+	// 过期的键在访问时删除
+	c.add("expired", NewByteView([]byte("v"), time.Now().Add(-time.Second)))
+	if _, ok := c.get("expired"); ok {
+		t.Fatalf("expired key should not be returned")
+	}
+	c.remove("1")
+	if _, ok := c.get("1"); ok {
+		t.Fatalf("removed key should not be returned")
+	}
+}
+
+func TestCache_Policies(t *testing.T) {
+	policies := map[string]Policy{
+		"LRU":       LRU(),
+		"LFU":       LFU(),
+		"FIFO":      FIFO(),
+		"Random":    Random(),
+		"ApproxLRU": ApproxLRU(5),
+		"TinyLFU":   TinyLFU(10),
+	}
+	for name, p := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := &cache{cacheBytes: 40, policy: p}
+			for i := 0; i < 100; i++ {
+				key := strconv.Itoa(i)
+				c.add(key, NewByteView([]byte(key), time.Time{}))
+				if nBytes := c.segments[0].store.(*policyStore).nBytes; nBytes > c.cacheBytes {
+					t.Fatalf("cache bytes %d exceed %d", nBytes, c.cacheBytes)
+				}
+			}
+		})
+	}
+
+	// 不淘汰
+	c := &cache{cacheBytes: 40, policy: Default()}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, NewByteView([]byte(key), time.Time{}))
+	}
+	if _, ok := c.get("0"); !ok {
+		t.Fatalf("default policy should not evict")
+	}
+}
+
+func TestGroup_Policy(t *testing.T) {
+	getter := ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	})
+	g := NewGroup("policy", 2<<10, getter, WithMainCachePolicy(LFU()), WithHotCachePolicy(TinyLFU(100)), WithHotCache(1<<10))
+	if _, err := g.GetContext(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	g.hotCache.add("b", NewByteView([]byte("b"), time.Time{}))
+	if _, ok := g.mainCache.segments[0].store.(*policyStore).cache.(*policy.LFU[string, ByteView]); !ok {
+		t.Fatalf("main cache policy is %T", g.mainCache.segments[0].store.(*policyStore).cache)
+	}
+	if _, ok := g.hotCache.segments[0].store.(*policyStore).cache.(*policy.TinyLFU[string, ByteView]); !ok {
+		t.Fatalf("hot cache policy is %T", g.hotCache.segments[0].store.(*policyStore).cache)
+	}
+
+	// 默认使用lru.Cache
+	g = NewGroup("policy-default", 2<<10, getter)
+	if _, err := g.GetContext(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.segments[0].store.(*lruStore); !ok {
+		t.Fatalf("default main cache store is %T", g.mainCache.segments[0].store)
+	}
+}
+
+func TestCache_Shards(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, shards: 8, policy: LRU()}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, NewByteView([]byte(key), time.Time{}))
+	}
+	var total, used int
+	for _, s := range c.segments {
+		if s.store == nil {
+			continue
+		}
+		nBytes := s.store.(*policyStore).nBytes
+		if nBytes > c.cacheBytes/len(c.segments) {
+			t.Fatalf("segment bytes %d exceed %d", nBytes, c.cacheBytes/len(c.segments))
+		}
+		total += nBytes
+		used++
+	}
+	if total > c.cacheBytes || used < 2 {
+		t.Fatalf("%d segments used %d bytes", used, total)
+	}
+	for i := 990; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := c.get(key); !ok || v.String() != key {
+			t.Fatalf("get %s=%s exist=%v", key, v.String(), ok)
+		}
+	}
+	c.remove("999")
+	if _, ok := c.get("999"); ok {
+		t.Fatalf("removed key should not be returned")
+	}
+}
+
+// go test -run=^$ -bench=BenchmarkCache -cpu=1,2,4,8,16,32,64
+func BenchmarkCache_Get(b *testing.B) {
+	for _, shards := range []int{1, 16, 64, 256} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkCache(b, &cache{cacheBytes: 64 << 20, shards: shards}, 100)
+		})
+	}
+}
+
+func BenchmarkCache_GetSet(b *testing.B) {
+	for _, shards := range []int{1, 16, 64, 256} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkCache(b, &cache{cacheBytes: 64 << 20, shards: shards}, 90)
+		})
+	}
+}
+
+// getPercent为读操作的百分比
+func benchmarkCache(b *testing.B, c *cache, getPercent int) {
+	const n = 1 << 16
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.add(keys[i], NewByteView([]byte(keys[i]), time.Time{}))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		i := int(fnv32a(strconv.Itoa(int(time.Now().UnixNano()))))
+		for p.Next() {
+			key := keys[i&(n-1)]
+			if i%100 < getPercent {
+				c.get(key)
+			} else {
+				c.add(key, NewByteView([]byte(key), time.Time{}))
+			}
+			i++
+		}
+	})
+}
+
+func TestCache_Janitor(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, janitorInterval: 10 * time.Millisecond}
+	c.add("a", NewByteView([]byte("a"), time.Now().Add(20*time.Millisecond)))
+	c.add("b", NewByteView([]byte("b"), time.Time{}))
+	defer c.segments[0].store.(*lruStore).StopJanitor()
+	time.Sleep(100 * time.Millisecond)
+	stats := c.stats()
+	if stats.Items != 1 || stats.Evictions != 1 {
+		t.Fatalf("janitor did not remove expired key, stats=%+v", stats)
+	}
+}
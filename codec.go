@@ -0,0 +1,60 @@
+package gcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec 用于V和字节数组之间的转换
+type Codec[V any] interface {
+	Marshal(v V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// JSONCodec 使用JSON编码
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(v V) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec 使用gob编码
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Marshal(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// ProtoCodec 使用protobuf编码，V是生成的消息指针类型，比如*gcachepb.Request
+type ProtoCodec[V proto.Message] struct{}
+
+func (ProtoCodec[V]) Marshal(v V) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[V]) Unmarshal(data []byte) (V, error) {
+	// 生成的消息类型在nil指针上也能获取消息类型信息
+	var zero V
+	v := proto.MessageReflect(zero).Type().New().Interface().(V)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
@@ -1,11 +1,13 @@
 package gcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	pb "github.com/jiaxwu/gcache/gcachepb"
-	"golang.org/x/sync/singleflight"
-	"log"
+	"github.com/jiaxwu/gcache/singleflight"
+	"golang.org/x/sync/errgroup"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -21,6 +23,37 @@ func (f GetterFunc) Get(key string) (ByteView, error) {
 	return f(key)
 }
 
+// ContextGetter 支持ctx的Getter
+// Getter实现了该接口时，加载使用GetContext，ctx可能带有调用方的截止时间，加载应该在ctx结束时尽快返回
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, key string) (ByteView, error)
+}
+
+type ContextGetterFunc func(ctx context.Context, key string) (ByteView, error)
+
+func (f ContextGetterFunc) Get(key string) (ByteView, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) (ByteView, error) {
+	return f(ctx, key)
+}
+
+// BatchGetter 用于批量加载数据
+// Getter实现了该接口时，GetMany会把本地未命中的key通过一次调用加载
+// 返回结果中缺少的key视为加载失败
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) (map[string]ByteView, error)
+}
+
+// 多个调用方共享的加载的默认超时时间
+const defaultLoadTimeout = 30 * time.Second
+
+// ErrNotFound key不存在
+// Getter返回该错误（可以被包装）时，才会走缓存空值机制
+var ErrNotFound = errors.New("gcache: not found")
+
 // Group 一个缓存命名空间
 type Group struct {
 	name      string
@@ -30,11 +63,157 @@ type Group struct {
 	// 用于获取远程节点请求客户端
 	peers PeerPicker
 	// 避免对同一个key多次加载
-	loadGroup *singleflight.Group
+	loadGroup *singleflight.Group[ByteView]
 	// 避免对同一个key多次删除
-	removeGroup *singleflight.Group
-	// getter返回error时对应空值key的过期时间
+	removeGroup *singleflight.Group[struct{}]
+	// getter返回ErrNotFound时对应空值key的过期时间
 	emptyKeyDuration time.Duration
+	// hotCache的淘汰策略
+	hotCachePolicy Policy
+	// hotCache的分片数量
+	hotCacheShards int
+	// 距离过期小于该时间时，读取会触发后台刷新
+	refreshAhead time.Duration
+	// 过期后仍然可以返回旧值的时间，同时会触发后台刷新
+	staleGrace time.Duration
+	// 正在后台刷新的key
+	refreshing sync.Map
+	// 后台清理过期键的间隔
+	janitorInterval time.Duration
+	// 没有过期时间的值使用的TTL
+	defaultTTL time.Duration
+	// 最大TTL
+	maxTTL time.Duration
+	// TTL的随机抖动
+	ttlJitter time.Duration
+	// 多个调用方共享的加载的超时时间
+	loadTimeout time.Duration
+	// 统计信息
+	stats groupStats
+	// 为nil时使用全局日志
+	logger Logger
+}
+
+// GroupOption Group的可选配置
+type GroupOption func(g *Group)
+
+// WithPolicy 设置mainCache和hotCache的淘汰策略
+func WithPolicy(p Policy) GroupOption {
+	return func(g *Group) {
+		g.SetPolicy(p)
+	}
+}
+
+// WithMainCachePolicy 设置mainCache的淘汰策略
+func WithMainCachePolicy(p Policy) GroupOption {
+	return func(g *Group) {
+		g.mainCache.policy = p
+	}
+}
+
+// WithHotCachePolicy 设置hotCache的淘汰策略
+func WithHotCachePolicy(p Policy) GroupOption {
+	return func(g *Group) {
+		g.hotCachePolicy = p
+		if g.hotCache != nil {
+			g.hotCache.policy = p
+		}
+	}
+}
+
+// WithShards 设置mainCache和hotCache的分片数量，减少多核下的锁竞争
+// 每个分片的最大字节数为总字节数除以分片数量
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.shards = n
+		g.hotCacheShards = n
+		if g.hotCache != nil {
+			g.hotCache.shards = n
+		}
+	}
+}
+
+// WithLogger 设置日志，默认使用全局日志
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// WithRefreshAhead 设置提前刷新窗口
+// 读取距离过期小于window的值时，在后台重新加载，避免过期后调用方等待加载
+func WithRefreshAhead(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = window
+	}
+}
+
+// WithStaleGrace 设置过期值的宽限期
+// 值过期后grace时间内仍然返回旧值并在后台重新加载，重新加载失败时继续返回旧值
+func WithStaleGrace(grace time.Duration) GroupOption {
+	return func(g *Group) {
+		g.staleGrace = grace
+		g.mainCache.grace = grace
+		if g.hotCache != nil {
+			g.hotCache.grace = grace
+		}
+	}
+}
+
+// WithJanitor 在后台每隔interval主动删除mainCache和hotCache中过期的键
+// 只对默认的LRU缓存生效，其他淘汰策略只在访问时删除过期的键
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+		g.mainCache.janitorInterval = interval
+		if g.hotCache != nil {
+			g.hotCache.janitorInterval = interval
+		}
+	}
+}
+
+// WithDefaultTTL 设置没有过期时间的值的TTL，包括缓存的空值
+func WithDefaultTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.defaultTTL = ttl
+	}
+}
+
+// WithMaxTTL 设置最大TTL，超过的过期时间会被截断，没有过期时间的值也会在maxTTL后过期
+func WithMaxTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.maxTTL = ttl
+	}
+}
+
+// WithTTLJitter 设置TTL的随机抖动，值会提前[0, jitter)之间的随机时间过期
+// 避免同时加载的大量key同时过期，导致请求同时打到数据源
+func WithTTLJitter(jitter time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttlJitter = jitter
+	}
+}
+
+// WithLoadTimeout 设置加载的超时时间，默认30秒，为0表示不限制
+// 同一个key的并发加载只执行一次，不使用任何一个调用方的截止时间，调用方只等待到自己的ctx结束
+func WithLoadTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = timeout
+	}
+}
+
+// WithHotCache 设置hotCache的最大字节数，见SetHotCache
+func WithHotCache(cacheBytes int) GroupOption {
+	return func(g *Group) {
+		g.SetHotCache(cacheBytes)
+	}
+}
+
+// WithEmptyWhenError 见SetEmptyWhenError
+func WithEmptyWhenError(duration time.Duration) GroupOption {
+	return func(g *Group) {
+		g.SetEmptyWhenError(duration)
+	}
 }
 
 var (
@@ -45,7 +224,8 @@ var (
 )
 
 // NewGroup 创建一个Group
-func NewGroup(name string, cacheBytes int, getter Getter) *Group {
+// 默认mainCache和hotCache都使用LRU淘汰，可以通过opts设置其他淘汰策略
+func NewGroup(name string, cacheBytes int, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -57,8 +237,12 @@ func NewGroup(name string, cacheBytes int, getter Getter) *Group {
 		mainCache: &cache{
 			cacheBytes: cacheBytes,
 		},
-		loadGroup:   &singleflight.Group{},
-		removeGroup: &singleflight.Group{},
+		loadGroup:   &singleflight.Group[ByteView]{},
+		removeGroup: &singleflight.Group[struct{}]{},
+		loadTimeout: defaultLoadTimeout,
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
 	groups[name] = g
 	return g
@@ -79,7 +263,8 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-// SetEmptyWhenError 当getter返回error时设置空值，缓解缓存穿透问题
+// SetEmptyWhenError 当getter返回ErrNotFound时设置空值，缓解缓存穿透问题
+// 命中空值时Get返回ErrNotFound，getter返回其他错误时不会设置空值
 // 为0表示该机制不生效
 func (g *Group) SetEmptyWhenError(duration time.Duration) {
 	g.emptyKeyDuration = duration
@@ -90,110 +275,530 @@ func (g *Group) SetHotCache(cacheBytes int) {
 	if cacheBytes <= 0 {
 		panic("hot cache must be greater than 0")
 	}
+	if g.hotCache != nil {
+		g.hotCache.close()
+	}
 	g.hotCache = &cache{
-		cacheBytes: cacheBytes,
+		cacheBytes:      cacheBytes,
+		policy:          g.hotCachePolicy,
+		shards:          g.hotCacheShards,
+		grace:           g.staleGrace,
+		janitorInterval: g.janitorInterval,
+	}
+}
+
+// SetPolicy 设置mainCache和hotCache的淘汰策略，默认使用LRU
+// 需要在使用Group之前调用
+func (g *Group) SetPolicy(p Policy) {
+	g.mainCache.policy = p
+	g.hotCachePolicy = p
+	if g.hotCache != nil {
+		g.hotCache.policy = p
+	}
+}
+
+// Close 停止Group的后台任务，比如清理过期键的协程
+// 关闭后仍然可以读写，但是不再主动清理过期键
+func (g *Group) Close() {
+	g.mainCache.close()
+	if g.hotCache != nil {
+		g.hotCache.close()
 	}
 }
 
 // Get 从缓存获取key对应的value
+// key不存在并且命中了缓存的空值时返回ErrNotFound
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 同Get，ctx结束时返回，ctx的截止时间会传递给远程节点
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	v, err := g.get(ctx, key)
+	if err == nil && v.notFound {
+		return ByteView{}, ErrNotFound
+	}
+	return v, err
+}
+
+// 获取key对应的value，缓存的空值也会返回
+func (g *Group) get(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[Cache] main cache hit")
+	g.stats.gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
 		return v, nil
 	}
-	if g.hotCache != nil {
-		if v, ok := g.hotCache.get(key); ok {
-			log.Println("[Cache] hot cache hit")
-			return v, nil
+	return g.load(ctx, key)
+}
+
+// GetMany 批量从缓存获取keys对应的values
+// 未命中的key按照所在节点分组，每个远程节点只请求一次
+// 返回成功获取的key-value，加载失败的key不在结果中，此时error为其中一个key的失败原因
+// 命中缓存空值的key也不在结果中，此时error为ErrNotFound
+func (g *Group) GetMany(keys []string) (map[string]ByteView, error) {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext 同GetMany，ctx结束时返回，没有获取到的key错误为ctx.Err()
+func (g *Group) GetManyContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values, errs, err := g.getMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if keyErr, ok := errs[key]; ok && err == nil {
+			err = fmt.Errorf("failed to get key %s: %w", key, keyErr)
+		}
+		if v, ok := values[key]; ok && v.notFound {
+			delete(values, key)
+			if err == nil {
+				err = fmt.Errorf("failed to get key %s: %w", key, ErrNotFound)
+			}
 		}
 	}
-	return g.load(key)
+	return values, err
+}
+
+// 批量获取key对应的value，缓存的空值也会返回
+// 同时返回加载失败的key和对应的错误
+func (g *Group) getMany(ctx context.Context, keys []string) (map[string]ByteView, map[string]error, error) {
+	values := make(map[string]ByteView, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if key == "" {
+			return nil, nil, fmt.Errorf("key is required")
+		}
+		g.stats.gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			values[key] = v
+			continue
+		}
+		misses = append(misses, key)
+	}
+	if len(misses) == 0 {
+		return values, nil, nil
+	}
+	loaded, errs := g.loadMany(ctx, misses)
+	for key, value := range loaded {
+		values[key] = value
+	}
+	return values, errs, nil
 }
 
 // Remove 从缓存删除key
 func (g *Group) Remove(key string) error {
-	_, err, _ := g.loadGroup.Do(key, func() (any, error) {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 同Remove，ctx的截止时间会传递给远程节点
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	_, err, _ := g.removeGroup.Do(key, func() (struct{}, error) {
 		// 从目标远程节点删除
 		var owner PeerGetter
 		if g.peers != nil {
 			peer, ok := g.peers.PickPeer(key)
 			if ok {
 				owner = peer
-				if err := g.removeFromPeer(peer, key); err != nil {
-					return nil, err
+				if err := g.removeFromPeer(ctx, peer, key); err != nil {
+					return struct{}{}, err
 				}
 			}
 		}
 		// 从本地缓存删除
 		g.removeLocally(key)
 		// 从其他远程节点删除
-		if g.peers != nil {
-			var wg sync.WaitGroup
-			var err error
-			for _, peer := range g.peers.GetAll() {
-				if peer == owner {
+		return struct{}{}, g.removeFromOthers(ctx, owner, key)
+	})
+	return err
+}
+
+// Set 设置key对应的value
+// value会写入拥有该key的节点，其他节点上的副本会被删除
+func (g *Group) Set(key string, value ByteView) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext 同Set，ctx的截止时间会传递给远程节点
+func (g *Group) SetContext(ctx context.Context, key string, value ByteView) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	// 写入目标远程节点
+	var owner PeerGetter
+	if g.peers != nil {
+		peer, ok := g.peers.PickPeer(key)
+		if ok {
+			owner = peer
+			if err := g.setToPeer(ctx, peer, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	if owner == nil {
+		// 自己就是目标节点
+		g.setLocally(key, value)
+	} else {
+		// 本地的副本已经过时
+		g.removeLocally(key)
+	}
+	// 从其他远程节点删除
+	return g.removeFromOthers(ctx, owner, key)
+}
+
+// 获取日志
+func (g *Group) log() Logger {
+	if g.logger != nil {
+		return g.logger
+	}
+	return getLogger()
+}
+
+// 处理远程节点的获取请求，key不存在时返回NotFound的响应
+func (g *Group) serveGet(ctx context.Context, key string) (*pb.Response, error) {
+	view, err := g.get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return &pb.Response{NotFound: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toResponse(view), nil
+}
+
+// 处理远程节点的批量获取请求，不存在的key返回NotFound的响应
+// 部分key加载失败时只返回成功的部分，全部失败时返回其中一个key的失败原因
+func (g *Group) serveGetMany(ctx context.Context, keys []string) (*pb.BatchResponse, error) {
+	views, errs, err := g.getMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.BatchResponse{Values: make(map[string]*pb.Response, len(keys))}
+	for key, view := range views {
+		out.Values[key] = toResponse(view)
+	}
+	for _, key := range keys {
+		keyErr, ok := errs[key]
+		if !ok {
+			continue
+		}
+		if errors.Is(keyErr, ErrNotFound) {
+			out.Values[key] = &pb.Response{NotFound: true}
+		} else if err == nil {
+			err = fmt.Errorf("failed to get key %s: %w", key, keyErr)
+		}
+	}
+	if len(out.Values) == 0 && err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// 从mainCache和hotCache查找
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		g.stats.mainCacheHits.Add(1)
+		g.maybeRefresh(key, v)
+		return v, true
+	}
+	if g.hotCache != nil {
+		if v, ok := g.hotCache.get(key); ok {
+			g.stats.hotCacheHits.Add(1)
+			g.maybeRefresh(key, v)
+			return v, true
+		}
+	}
+	return ByteView{}, false
+}
+
+// 值已经过期或者即将过期时在后台刷新
+func (g *Group) maybeRefresh(key string, value ByteView) {
+	if value.expire.IsZero() || (g.refreshAhead == 0 && g.staleGrace == 0) {
+		return
+	}
+	if time.Until(value.expire) >= g.refreshAhead {
+		return
+	}
+	// 同一个key同时只有一个后台刷新
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		g.stats.loads.Add(1)
+		// 与普通加载一样受loadTimeout限制，源站卡住时不会一直占据该key的刷新
+		_, err, _ := g.loadGroup.DoContext(context.Background(), key, func(ctx context.Context) (ByteView, error) {
+			ctx, cancel := g.withLoadTimeout(ctx)
+			defer cancel()
+			return g.doLoad(ctx, key, true)
+		})
+		if err != nil {
+			g.log().Warn("failed to refresh", "group", g.name, "key", key, "err", err)
+		}
+	}()
+}
+
+// 加载缓存
+// 同一个key的并发加载共享一次加载，加载使用的ctx不随任何一个调用方取消，超时时间为loadTimeout，
+// 每个调用方只等待到自己的ctx结束，所有调用方都放弃后才取消加载
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	g.stats.loads.Add(1)
+	view, err, _ := g.loadGroup.DoContext(ctx, key, func(ctx context.Context) (ByteView, error) {
+		ctx, cancel := g.withLoadTimeout(ctx)
+		defer cancel()
+		return g.doLoad(ctx, key, false)
+	})
+	return view, err
+}
+
+// 为共享的加载设置loadTimeout，为0时不限制
+func (g *Group) withLoadTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.loadTimeout > 0 {
+		return context.WithTimeout(ctx, g.loadTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// 从远程节点或者本地加载key
+// refresh为true表示后台刷新，加载失败时不设置空值，保留旧值
+func (g *Group) doLoad(ctx context.Context, key string, refresh bool) (ByteView, error) {
+	g.stats.loadsDeduped.Add(1)
+	// 本地加载的结果写入mainCache
+	target := g.mainCache
+	// 拥有者不可用的时间
+	var unavailable time.Duration
+	// 先判断是否需要从远程加载
+	if g.peers != nil {
+		// ok代表需要从远程加载
+		if peer, ok := g.peers.PickPeer(key); ok {
+			value, err := g.loadFromPeer(ctx, peer, key)
+			if err == nil {
+				g.stats.peerLoads.Add(1)
+				return g.populateCache(key, value, g.hotCache), nil
+			}
+			// 远程节点确认key不存在，不需要再从本地加载
+			if errors.Is(err, ErrNotFound) {
+				g.stats.peerLoads.Add(1)
+				return ByteView{}, err
+			}
+			if errors.Is(err, ErrPeerUnavailable) {
+				// 目标节点暂时不可用，从本地加载，只在hotCache中短暂保存
+				g.log().Debug("peer unavailable", "group", g.name, "key", key, "err", err)
+				target, unavailable = nil, retryAfter(err)
+			} else {
+				g.stats.peerErrors.Add(1)
+				g.log().Warn("failed to get from peer", "group", g.name, "key", key, "err", err)
+				// 所有调用方都已经放弃或者加载超时，不再从本地加载
+				if ctx.Err() != nil {
+					return ByteView{}, ctx.Err()
+				}
+			}
+		}
+	}
+	// 否则从本地加载
+	var value ByteView
+	var err error
+	if refresh {
+		value, err = g.getLocally(ctx, key)
+		// 其他错误可能是暂时的，保留旧值
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			g.stats.localLoadErrs.Add(1)
+			return ByteView{}, err
+		}
+		value, err = g.populateLocally(key, value, err, target)
+	} else {
+		value, err = g.loadLocally(ctx, key, target)
+	}
+	if err == nil && target == nil {
+		value = g.populateBriefly(key, value, unavailable)
+	}
+	return value, err
+}
+
+// 批量加载缓存
+// 与load共用loadGroup，正在加载的key不会被重复加载，加载使用的ctx同样不随调用方取消
+func (g *Group) loadMany(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	g.stats.loads.Add(int64(len(keys)))
+	return g.loadGroup.DoMany(ctx, keys, func(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+		ctx, cancel := g.withLoadTimeout(ctx)
+		defer cancel()
+		g.stats.loadsDeduped.Add(int64(len(keys)))
+		// 按照所在节点对key分组
+		// uncached为所在节点暂时不可用的key，从本地加载，只在hotCache中保存unavailable
+		var locals, uncached []string
+		var unavailable time.Duration
+		peerKeys := make(map[PeerGetter][]string)
+		for _, key := range keys {
+			if g.peers != nil {
+				if peer, ok := g.peers.PickPeer(key); ok {
+					peerKeys[peer] = append(peerKeys[peer], key)
 					continue
 				}
-				wg.Add(1)
-				go func(peer PeerGetter) {
-					if err0 := g.removeFromPeer(peer, key); err0 != nil {
-						err = err0
+			}
+			locals = append(locals, key)
+		}
+		// 每个远程节点发起一次批量请求
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		values := make(map[string]ByteView, len(keys))
+		errs := make(map[string]error)
+		for peer, keys := range peerKeys {
+			wg.Add(1)
+			go func(peer PeerGetter, keys []string) {
+				defer wg.Done()
+				peerValues, peerErrs, err := g.loadManyFromPeer(ctx, peer, keys)
+				mu.Lock()
+				defer mu.Unlock()
+				if errors.Is(err, ErrPeerUnavailable) {
+					g.log().Debug("peer unavailable", "group", g.name, "keys", len(keys), "err", err)
+					uncached = append(uncached, keys...)
+					if d := retryAfter(err); unavailable == 0 || d < unavailable {
+						unavailable = d
+					}
+					return
+				}
+				if err != nil {
+					g.stats.peerErrors.Add(1)
+					g.log().Warn("failed to get many from peer", "group", g.name, "keys", len(keys), "err", err)
+					// 远程节点失败时从本地加载
+					locals = append(locals, keys...)
+					return
+				}
+				g.stats.peerLoads.Add(int64(len(peerValues) + len(peerErrs)))
+				for key, value := range peerValues {
+					values[key] = g.populateCache(key, value, g.hotCache)
+				}
+				// 远程节点确认key不存在，不需要再从本地加载
+				for key, err := range peerErrs {
+					errs[key] = err
+				}
+				// 远程节点没有返回的key（比如加载失败或者已经过期）从本地加载
+				for _, key := range keys {
+					if _, ok := values[key]; !ok && errs[key] == nil {
+						locals = append(locals, key)
 					}
-					wg.Done()
-				}(peer)
+				}
+			}(peer, keys)
+		}
+		wg.Wait()
+		// 所有调用方都已经放弃或者加载超时，不再从本地加载
+		if ctx.Err() != nil {
+			for _, key := range append(locals, uncached...) {
+				errs[key] = ctx.Err()
 			}
-			wg.Wait()
-			if err != nil {
-				return nil, err
+			return values, errs
+		}
+		localValues, localErrs := g.loadManyLocally(ctx, locals, g.mainCache)
+		uncachedValues, uncachedErrs := g.loadManyLocally(ctx, uncached, nil)
+		for key, value := range uncachedValues {
+			uncachedValues[key] = g.populateBriefly(key, value, unavailable)
+		}
+		for _, loaded := range []map[string]ByteView{localValues, uncachedValues} {
+			for key, value := range loaded {
+				values[key] = value
 			}
 		}
-		return nil, nil
+		for _, loadErrs := range []map[string]error{localErrs, uncachedErrs} {
+			for key, err := range loadErrs {
+				errs[key] = err
+			}
+		}
+		return values, errs
 	})
-	return err
 }
 
-// 加载缓存
-func (g *Group) load(key string) (ByteView, error) {
-	view, err, _ := g.loadGroup.Do(key, func() (any, error) {
-		// 先判断是否需要从远程加载
-		if g.peers != nil {
-			// ok代表需要从远程加载
-			if peer, ok := g.peers.PickPeer(key); ok {
-				value, err := g.loadFromPeer(peer, key)
-				if err == nil {
-					g.populateCache(key, value, g.hotCache)
-					return value, nil
+// 调用getter加载，getter实现了ContextGetter时传递ctx
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	if getter, ok := g.getter.(ContextGetter); ok {
+		return getter.GetContext(ctx, key)
+	}
+	return g.getter.Get(key)
+}
+
+// 从本地节点加载缓存值并写入cache，cache为nil时不缓存
+func (g *Group) loadLocally(ctx context.Context, key string, cache *cache) (ByteView, error) {
+	value, err := g.getLocally(ctx, key)
+	return g.populateLocally(key, value, err, cache)
+}
+
+// 从本地节点批量加载缓存值
+// getter不支持批量加载时并发逐个加载，cache为nil时不缓存
+func (g *Group) loadManyLocally(ctx context.Context, keys []string, cache *cache) (map[string]ByteView, map[string]error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	if len(keys) == 0 {
+		return values, errs
+	}
+	if getter, ok := g.getter.(BatchGetter); ok {
+		loaded, err := getter.GetMany(ctx, keys)
+		for _, key := range keys {
+			value, ok := loaded[key]
+			var keyErr error
+			if !ok {
+				keyErr = err
+				if keyErr == nil {
+					keyErr = fmt.Errorf("%s not returned by getter", key)
 				}
-				log.Printf("[Cache] failed to get from peer key=%s, err=%v\n", key, err)
+			}
+			if value, keyErr = g.populateLocally(key, value, keyErr, cache); keyErr != nil {
+				errs[key] = keyErr
+			} else {
+				values[key] = value
 			}
 		}
-		// 否则从本地加载
-		return g.loadLocally(key)
-	})
-	if err != nil {
-		return ByteView{}, err
+		return values, errs
 	}
-	return view.(ByteView), nil
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			value, err := g.loadLocally(ctx, key, cache)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[key] = err
+			} else {
+				values[key] = value
+			}
+		}(key)
+	}
+	wg.Wait()
+	return values, errs
 }
 
-// 从本地节点加载缓存值
-func (g *Group) loadLocally(key string) (ByteView, error) {
-	value, err := g.getter.Get(key)
+// 把本地加载的结果发布到cache，cache为nil时不缓存
+func (g *Group) populateLocally(key string, value ByteView, err error, cache *cache) (ByteView, error) {
 	if err != nil {
-		if g.emptyKeyDuration == 0 {
+		g.stats.localLoadErrs.Add(1)
+		// 只缓存不存在的key，其他错误可能是暂时的
+		if g.emptyKeyDuration == 0 || !errors.Is(err, ErrNotFound) {
 			return ByteView{}, err
 		}
 		// 走缓存空值机制
 		value = ByteView{
-			expire: time.Now().Add(g.emptyKeyDuration),
+			expire:   time.Now().Add(g.emptyKeyDuration),
+			notFound: true,
 		}
+	} else {
+		g.stats.localLoads.Add(1)
 	}
-	g.populateCache(key, value, g.mainCache)
-	return value, nil
+	return g.populateCache(key, value, cache), nil
+}
+
+// 拥有者暂时不可用时，把本地加载的值在hotCache中保存ttl
+// 避免拥有者恢复之前每次都请求数据源，也避免拥有者恢复后长时间返回旧值
+func (g *Group) populateBriefly(key string, value ByteView, ttl time.Duration) ByteView {
+	if expire := time.Now().Add(ttl); value.expire.IsZero() || value.expire.After(expire) {
+		value.expire = expire
+	}
+	if g.hotCache != nil {
+		g.hotCache.add(key, value)
+	}
+	return value
 }
 
 // 从本地节点删除缓存
@@ -204,40 +809,138 @@ func (g *Group) removeLocally(key string) {
 	}
 }
 
+// 设置到本地节点缓存
+func (g *Group) setLocally(key string, value ByteView) {
+	g.populateCache(key, value, g.mainCache)
+	if g.hotCache != nil {
+		g.hotCache.remove(key)
+	}
+}
+
 // 发布到缓存
-func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if cache == nil {
-		return
+// 返回调整过期时间后的值
+func (g *Group) populateCache(key string, value ByteView, cache *cache) ByteView {
+	value.expire = g.adjustExpire(value.expire)
+	if cache != nil {
+		cache.add(key, value)
 	}
-	cache.add(key, value)
+	return value
+}
+
+// 根据默认TTL、最大TTL和随机抖动调整过期时间
+func (g *Group) adjustExpire(expire time.Time) time.Time {
+	if g.defaultTTL == 0 && g.maxTTL == 0 && g.ttlJitter == 0 {
+		return expire
+	}
+	now := time.Now()
+	if expire.IsZero() && g.defaultTTL > 0 {
+		expire = now.Add(g.defaultTTL)
+	}
+	if g.maxTTL > 0 && (expire.IsZero() || expire.Sub(now) > g.maxTTL) {
+		expire = now.Add(g.maxTTL)
+	}
+	// 提前[0, jitter)随机过期，不超过剩余时间
+	if g.ttlJitter > 0 && !expire.IsZero() {
+		if jitter := minDuration(g.ttlJitter, expire.Sub(now)); jitter > 0 {
+			expire = expire.Add(-time.Duration(rand.Int63n(int64(jitter))))
+		}
+	}
+	return expire
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 // 从远程节点加载缓存值
-func (g *Group) loadFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) loadFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	var res pb.Response
-	err := peer.Get(req, &res)
+	err := peer.GetContext(ctx, req, &res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	var expire time.Time
-	if res.Expire != 0 {
-		expire = time.Unix(res.Expire/int64(time.Second), res.Expire%int64(time.Second))
-		if time.Now().After(expire) {
-			return ByteView{}, errors.New("peer returned expired value")
+	value := fromResponse(&res)
+	// 远程节点没有缓存空值，不能在本地缓存
+	if value.notFound && value.expire.IsZero() {
+		return ByteView{}, ErrNotFound
+	}
+	// 宽限期内的过期值仍然可以使用
+	if !value.expire.IsZero() && time.Now().After(value.expire.Add(g.staleGrace)) {
+		return ByteView{}, errors.New("peer returned expired value")
+	}
+	return value, nil
+}
+
+// 从远程节点批量加载缓存值
+// 远程节点确认不存在并且没有缓存空值的key返回ErrNotFound
+func (g *Group) loadManyFromPeer(ctx context.Context, peer PeerGetter, keys []string) (map[string]ByteView, map[string]error, error) {
+	req := &pb.BatchRequest{
+		Group: g.name,
+		Keys:  keys,
+	}
+	var res pb.BatchResponse
+	if err := peer.GetManyContext(ctx, req, &res); err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	values := make(map[string]ByteView, len(res.Values))
+	errs := make(map[string]error)
+	for key, res := range res.Values {
+		value := fromResponse(res)
+		// 远程节点没有缓存空值，不能在本地缓存
+		if value.notFound && value.expire.IsZero() {
+			errs[key] = ErrNotFound
+			continue
+		}
+		if !value.expire.IsZero() && now.After(value.expire.Add(g.staleGrace)) {
+			continue
 		}
+		values[key] = value
+	}
+	return values, errs, nil
+}
+
+// 设置远程节点缓存值
+func (g *Group) setToPeer(ctx context.Context, peer PeerGetter, key string, value ByteView) error {
+	req := &pb.SetRequest{
+		Group:  g.name,
+		Key:    key,
+		Value:  value.b,
+		Expire: toExpireNano(value.Expire()),
 	}
-	return ByteView{b: res.Value, expire: expire}, nil
+	return peer.SetContext(ctx, req)
 }
 
 // 从远程节点删除缓存值
-func (g *Group) removeFromPeer(peer PeerGetter, key string) error {
+func (g *Group) removeFromPeer(ctx context.Context, peer PeerGetter, key string) error {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
-	return peer.Remove(req)
+	return peer.RemoveContext(ctx, req)
+}
+
+// 从除了owner以外的所有远程节点删除缓存值
+func (g *Group) removeFromOthers(ctx context.Context, owner PeerGetter, key string) error {
+	if g.peers == nil {
+		return nil
+	}
+	var eg errgroup.Group
+	for _, peer := range g.peers.GetAll() {
+		if peer == owner {
+			continue
+		}
+		peer := peer
+		eg.Go(func() error {
+			return g.removeFromPeer(ctx, peer, key)
+		})
+	}
+	return eg.Wait()
 }
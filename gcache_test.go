@@ -1,12 +1,19 @@
 package gcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
 )
 
 func TestGetter(t *testing.T) {
@@ -58,3 +65,585 @@ func BenchmarkGet(b *testing.B) {
 		g.Get(strconv.Itoa(i))
 	}
 }
+
+// 记录请求的伙伴节点
+type fakePeer struct {
+	mu      sync.Mutex
+	sets    map[string]string
+	removes []string
+	batches [][]string
+	// 不存在的key返回缓存的空值
+	notFound bool
+	// 不存在的key返回没有缓存的空值
+	uncached bool
+	// 模拟熔断，所有请求返回ErrPeerUnavailable
+	unavailable bool
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p *fakePeer) Remove(in *pb.Request) error {
+	return p.RemoveContext(context.Background(), in)
+}
+
+func (p *fakePeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable {
+		return ErrPeerUnavailable
+	}
+	v, ok := p.sets[in.Key]
+	if !ok && p.notFound {
+		out.NotFound = true
+		out.Expire = time.Now().Add(time.Minute).UnixNano()
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%s does not exists", in.Key)
+	}
+	out.Value = []byte(v)
+	return nil
+}
+
+func (p *fakePeer) RemoveContext(ctx context.Context, in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable {
+		return ErrPeerUnavailable
+	}
+	p.removes = append(p.removes, in.Key)
+	return nil
+}
+
+func (p *fakePeer) SetContext(ctx context.Context, in *pb.SetRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable {
+		return ErrPeerUnavailable
+	}
+	if p.sets == nil {
+		p.sets = make(map[string]string)
+	}
+	p.sets[in.Key] = string(in.Value)
+	return nil
+}
+
+func (p *fakePeer) GetManyContext(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable {
+		return ErrPeerUnavailable
+	}
+	p.batches = append(p.batches, in.Keys)
+	out.Values = make(map[string]*pb.Response)
+	for _, key := range in.Keys {
+		if v, ok := p.sets[key]; ok {
+			out.Values[key] = &pb.Response{Value: []byte(v)}
+		} else if p.notFound {
+			out.Values[key] = &pb.Response{NotFound: true, Expire: time.Now().Add(time.Minute).UnixNano()}
+		} else if p.uncached {
+			out.Values[key] = &pb.Response{NotFound: true}
+		}
+	}
+	return nil
+}
+
+// 把以owner为前缀的key路由到对应的伙伴节点
+type fakePicker map[string]*fakePeer
+
+func (p fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	for owner, peer := range p {
+		if strings.HasPrefix(key, owner) {
+			return peer, true
+		}
+	}
+	return nil, false
+}
+
+func (p fakePicker) GetAll() []PeerGetter {
+	var peers []PeerGetter
+	for _, peer := range p {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func TestGroup_Set(t *testing.T) {
+	a, b := &fakePeer{}, &fakePeer{}
+	g := NewGroup("set", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return ByteView{}, fmt.Errorf("%s does not exists", key)
+	}))
+	g.RegisterPeers(fakePicker{"a": a, "b": b})
+	ctx := context.Background()
+
+	if err := g.SetContext(ctx, "a1", NewByteView([]byte("v1"), time.Time{})); err != nil {
+		t.Fatal(err)
+	}
+	if a.sets["a1"] != "v1" || len(a.removes) != 0 || len(b.removes) != 1 {
+		t.Fatalf("set a1 should write owner a and invalidate b, a=%v b=%v", a, b)
+	}
+	if view, err := g.GetContext(ctx, "a1"); err != nil || view.String() != "v1" {
+		t.Fatalf("get a1 failed, value=%s err=%v", view, err)
+	}
+
+	if err := g.SetContext(ctx, "local", NewByteView([]byte("v2"), time.Time{})); err != nil {
+		t.Fatal(err)
+	}
+	if view, ok := g.mainCache.get("local"); !ok || view.String() != "v2" {
+		t.Fatalf("set local key should populate main cache")
+	}
+	if len(a.removes) != 1 || len(b.removes) != 2 {
+		t.Fatalf("set local key should invalidate all peers, a=%v b=%v", a, b)
+	}
+}
+
+func TestGroup_PeerUnavailable(t *testing.T) {
+	a := &fakePeer{unavailable: true}
+	var loads AtomicInt
+	g := NewGroup("peer-unavailable", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		loads.Add(1)
+		return NewByteView([]byte(key), time.Time{}), nil
+	}), WithHotCache(1<<10))
+	g.RegisterPeers(fakePicker{"a": a})
+	ctx := context.Background()
+
+	// 拥有者熔断时从本地加载，不写入mainCache，只在hotCache中短暂保存
+	if view, err := g.GetContext(ctx, "a1"); err != nil || view.String() != "a1" {
+		t.Fatalf("get a1 failed, value=%s err=%v", view, err)
+	}
+	values, err := g.GetManyContext(ctx, []string{"a2", "a3"})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("get many values=%v err=%v", values, err)
+	}
+	for _, key := range []string{"a1", "a2", "a3"} {
+		if _, ok := g.mainCache.get(key); ok {
+			t.Fatalf("%s of unavailable peer should not be in main cache", key)
+		}
+		v, ok := g.hotCache.get(key)
+		if !ok || v.Expire().IsZero() || time.Until(v.Expire()) > defaultBreakerCooldown {
+			t.Fatalf("%s of unavailable peer should be in hot cache until cooldown, expire=%v", key, v.Expire())
+		}
+	}
+	if _, err := g.GetContext(ctx, "a1"); err != nil || loads.Get() != 3 {
+		t.Fatalf("second get should hit hot cache, loads=%d err=%v", loads.Get(), err)
+	}
+
+	// 拥有者熔断时写入和删除返回错误，不写入本地
+	if err := g.SetContext(ctx, "a1", NewByteView([]byte("v1"), time.Time{})); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("set err=%v, want ErrPeerUnavailable", err)
+	}
+	if _, ok := g.mainCache.get("a1"); ok {
+		t.Fatalf("set should not write locally when owner is unavailable")
+	}
+	if err := g.RemoveContext(ctx, "a1"); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("remove err=%v, want ErrPeerUnavailable", err)
+	}
+}
+
+// 支持批量加载的Getter
+type batchGetter struct {
+	db      map[string]string
+	batches [][]string
+}
+
+func (g *batchGetter) Get(key string) (ByteView, error) {
+	return ByteView{}, errors.New("should load in batch")
+}
+
+func (g *batchGetter) GetMany(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	g.batches = append(g.batches, keys)
+	values := make(map[string]ByteView)
+	for _, key := range keys {
+		if v, ok := g.db[key]; ok {
+			values[key] = NewByteView([]byte(v), time.Time{})
+		}
+	}
+	return values, nil
+}
+
+func TestGroup_GetMany(t *testing.T) {
+	a, b := &fakePeer{sets: map[string]string{"a1": "A1", "a2": "A2"}}, &fakePeer{sets: map[string]string{"b1": "B1"}}
+	getter := &batchGetter{db: map[string]string{"l1": "L1", "l2": "L2"}}
+	g := NewGroup("get-many", 2<<10, getter)
+	g.RegisterPeers(fakePicker{"a": a, "b": b})
+	ctx := context.Background()
+
+	keys := []string{"a1", "a2", "b1", "l1", "l2", "unknown"}
+	values, err := g.GetManyContext(ctx, keys)
+	if err == nil {
+		t.Fatalf("get many should report the unknown key")
+	}
+	for _, key := range keys[:5] {
+		if view, ok := values[key]; !ok || view.String() != strings.ToUpper(key) {
+			t.Fatalf("get many %s failed, value=%s", key, view)
+		}
+	}
+	if _, ok := values["unknown"]; ok {
+		t.Fatalf("unknown key should not be returned")
+	}
+	if len(a.batches) != 1 || len(a.batches[0]) != 2 || len(b.batches) != 1 || len(getter.batches) != 1 {
+		t.Fatalf("expect one batch per peer, a=%v b=%v local=%v", a.batches, b.batches, getter.batches)
+	}
+
+	// 本地key已经缓存
+	if values, err := g.GetManyContext(ctx, []string{"l1", "l2"}); err != nil || len(values) != 2 || len(getter.batches) != 1 {
+		t.Fatalf("cached keys should not be loaded again, values=%v err=%v", values, err)
+	}
+
+	// 远程节点没有返回的key从本地加载
+	getter.db["a3"] = "A3"
+	values, err = g.GetManyContext(ctx, []string{"a3", "a4"})
+	if view, ok := values["a3"]; !ok || view.String() != "A3" || err == nil {
+		t.Fatalf("key omitted by peer should be loaded locally, values=%v err=%v", values, err)
+	}
+	if len(getter.batches) != 2 || len(getter.batches[1]) != 2 {
+		t.Fatalf("omitted keys should be loaded in one local batch, local=%v", getter.batches)
+	}
+}
+
+func TestGroup_RefreshAhead(t *testing.T) {
+	var mu sync.Mutex
+	var loads int
+	g := NewGroup("refresh-ahead", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads++
+		return NewByteView([]byte(strconv.Itoa(loads)), time.Now().Add(200*time.Millisecond)), nil
+	}), WithRefreshAhead(150*time.Millisecond))
+	ctx := context.Background()
+	if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "1" {
+		t.Fatalf("get a=%v err=%v", v, err)
+	}
+	// 距离过期较远时不刷新
+	g.GetContext(ctx, "a")
+	time.Sleep(100 * time.Millisecond)
+	// 即将过期，返回旧值并在后台刷新
+	if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "1" {
+		t.Fatalf("get a=%v err=%v, want old value", v, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "2" {
+		t.Fatalf("get a=%v err=%v, want refreshed value", v, err)
+	}
+}
+
+func TestGroup_RefreshTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var loads int
+	hang := false
+	g := NewGroup("refresh-timeout", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		mu.Lock()
+		loads++
+		n, block := loads, hang
+		mu.Unlock()
+		if block {
+			<-ctx.Done()
+			return ByteView{}, ctx.Err()
+		}
+		return NewByteView([]byte(strconv.Itoa(n)), time.Now().Add(100*time.Millisecond)), nil
+	}), WithRefreshAhead(time.Second), WithLoadTimeout(50*time.Millisecond))
+	ctx := context.Background()
+	g.GetContext(ctx, "a")
+	mu.Lock()
+	hang = true
+	mu.Unlock()
+	// 源站卡住时后台刷新在loadTimeout后结束，之后可以再次刷新
+	g.GetContext(ctx, "a")
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := g.refreshing.Load("a"); ok {
+		t.Fatalf("refresh still running after load timeout")
+	}
+	mu.Lock()
+	hang = false
+	mu.Unlock()
+	// 已经过期，等待新的加载
+	if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "3" {
+		t.Fatalf("get a=%v err=%v, want reloaded value", v, err)
+	}
+}
+
+func TestGroup_StaleGrace(t *testing.T) {
+	var mu sync.Mutex
+	var loads int
+	fail := false
+	g := NewGroup("stale-grace", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return ByteView{}, errors.New("origin down")
+		}
+		loads++
+		return NewByteView([]byte(strconv.Itoa(loads)), time.Now().Add(50*time.Millisecond)), nil
+	}), WithStaleGrace(time.Second), WithEmptyWhenError(time.Minute))
+	ctx := context.Background()
+	g.GetContext(ctx, "a")
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	// 已经过期，源站失败时继续返回旧值
+	for i := 0; i < 3; i++ {
+		if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "1" {
+			t.Fatalf("get a=%v err=%v, want stale value", v, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	g.GetContext(ctx, "a")
+	time.Sleep(20 * time.Millisecond)
+	if v, err := g.GetContext(ctx, "a"); err != nil || v.String() != "2" {
+		t.Fatalf("get a=%v err=%v, want refreshed value", v, err)
+	}
+}
+
+func TestGroup_LoadContext(t *testing.T) {
+	release := make(chan struct{})
+	loadErr := make(chan error, 1)
+	g := NewGroup("load-context", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		select {
+		case <-release:
+			return NewByteView([]byte(key), time.Time{}), nil
+		case <-ctx.Done():
+			loadErr <- ctx.Err()
+			return ByteView{}, ctx.Err()
+		}
+	}), WithLoadTimeout(time.Second))
+
+	// 第一个调用方超时不影响其他调用方共享的加载
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctx, "key")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string, 1)
+	go func() {
+		v, _ := g.GetContext(context.Background(), "key")
+		second <- v.String()
+	}()
+	if err := <-first; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("first caller err=%v", err)
+	}
+	close(release)
+	if v := <-second; v != "key" {
+		t.Fatalf("second caller value=%s", v)
+	}
+	select {
+	case err := <-loadErr:
+		t.Fatalf("shared load cancelled by first caller: %v", err)
+	default:
+	}
+
+	// 加载超过loadTimeout后取消
+	release = make(chan struct{})
+	g.loadTimeout = 20 * time.Millisecond
+	if _, err := g.GetContext(context.Background(), "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow load err=%v", err)
+	}
+}
+
+func TestGroup_LoadManyContext(t *testing.T) {
+	release := make(chan struct{})
+	loadErr := make(chan error, 1)
+	g := NewGroup("load-many-context", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		select {
+		case <-release:
+			return NewByteView([]byte(key), time.Time{}), nil
+		case <-ctx.Done():
+			loadErr <- ctx.Err()
+			return ByteView{}, ctx.Err()
+		}
+	}), WithLoadTimeout(time.Second))
+
+	// 批量调用方取消后，等待同一个key的Get仍然可以得到结果
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.GetManyContext(ctx, []string{"a", "b"})
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string, 1)
+	go func() {
+		v, _ := g.GetContext(context.Background(), "a")
+		second <- v.String()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first caller err=%v", err)
+	}
+	close(release)
+	if v := <-second; v != "a" {
+		t.Fatalf("second caller value=%s", v)
+	}
+	select {
+	case err := <-loadErr:
+		t.Fatalf("shared load cancelled by batch caller: %v", err)
+	default:
+	}
+
+	// 批量调用方只等待到自己的截止时间
+	release = make(chan struct{})
+	defer close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := g.GetManyContext(ctx, []string{"c", "d"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("batch caller err=%v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("batch caller blocked for %v", d)
+	}
+}
+
+func TestGroup_Close(t *testing.T) {
+	before := runtime.NumGoroutine()
+	g := NewGroup("close", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Now().Add(time.Minute)), nil
+	}), WithShards(8), WithJanitor(10*time.Millisecond), WithHotCache(1<<10))
+	for i := 0; i < 64; i++ {
+		key := strconv.Itoa(i)
+		g.GetContext(context.Background(), key)
+		g.hotCache.add(key, NewByteView([]byte(key), time.Time{}))
+	}
+	if n := runtime.NumGoroutine(); n < before+16 {
+		t.Fatalf("janitors not started, goroutines=%d before=%d", n, before)
+	}
+	// 替换hotCache时停止旧的清理协程
+	g.SetHotCache(1 << 10)
+	g.Close()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitors leaked, goroutines=%d before=%d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 关闭后仍然可以读写，但不再启动清理协程
+	g.GetContext(context.Background(), "new")
+	g.hotCache.add("new", NewByteView([]byte("new"), time.Time{}))
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("janitor started after close, goroutines=%d before=%d", n, before)
+	}
+}
+
+func TestGroup_TTL(t *testing.T) {
+	expires := map[string]time.Duration{
+		"none":  0,
+		"short": time.Minute,
+		"long":  24 * time.Hour,
+	}
+	g := NewGroup("ttl", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		ttl, ok := expires[key]
+		if !ok {
+			return ByteView{}, ErrNotFound
+		}
+		var expire time.Time
+		if ttl > 0 {
+			expire = time.Now().Add(ttl)
+		}
+		return NewByteView([]byte(key), expire), nil
+	}), WithDefaultTTL(10*time.Minute), WithMaxTTL(time.Hour), WithTTLJitter(time.Minute), WithEmptyWhenError(30*time.Second))
+	ttl := func(key string) time.Duration {
+		// 包括缓存的空值
+		v, err := g.get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached, ok := g.mainCache.get(key); !ok || !cached.Expire().Equal(v.Expire()) {
+			t.Fatalf("cached expire %v, returned %v", cached.Expire(), v.Expire())
+		}
+		return time.Until(v.Expire())
+	}
+	for key, want := range map[string][2]time.Duration{
+		"none":    {9 * time.Minute, 10 * time.Minute},
+		"short":   {0, time.Minute},
+		"long":    {59 * time.Minute, time.Hour},
+		"missing": {0, 30 * time.Second},
+	} {
+		if d := ttl(key); d <= want[0]-time.Second || d > want[1] {
+			t.Fatalf("%s ttl=%v, want (%v, %v]", key, d, want[0], want[1])
+		}
+	}
+
+	// 抖动使同时加载的key在不同时间过期
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		key := "none"
+		g.removeLocally(key)
+		seen[ttl(key).Round(time.Millisecond)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("jitter not applied, ttls=%v", seen)
+	}
+}
+
+func TestGroup_NotFound(t *testing.T) {
+	loads := make(map[string]int)
+	var mu sync.Mutex
+	g := NewGroup("not-found", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads[key]++
+		switch key {
+		case "missing":
+			return ByteView{}, fmt.Errorf("query %s: %w", key, ErrNotFound)
+		case "flaky":
+			return ByteView{}, errors.New("timeout")
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}), WithEmptyWhenError(time.Minute))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := g.GetContext(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get missing err=%v, want ErrNotFound", err)
+		}
+		if _, err := g.GetContext(ctx, "flaky"); err == nil || errors.Is(err, ErrNotFound) {
+			t.Fatalf("get flaky err=%v", err)
+		}
+	}
+	// 只缓存不存在的key
+	if loads["missing"] != 1 || loads["flaky"] != 2 {
+		t.Fatalf("loads=%v", loads)
+	}
+	values, err := g.GetManyContext(ctx, []string{"a", "missing"})
+	if !errors.Is(err, ErrNotFound) || len(values) != 1 || values["a"].String() != "a" {
+		t.Fatalf("get many values=%v err=%v", values, err)
+	}
+
+	// 远程节点返回的空值缓存到hotCache
+	peer := &fakePeer{notFound: true}
+	g.RegisterPeers(fakePicker{"peer": peer})
+	g.SetHotCache(1 << 10)
+	for i := 0; i < 2; i++ {
+		if _, err := g.GetContext(ctx, "peer-missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get peer-missing err=%v, want ErrNotFound", err)
+		}
+	}
+	if v, ok := g.hotCache.get("peer-missing"); !ok || !v.notFound || loads["peer-missing"] != 0 {
+		t.Fatalf("peer negative value not cached, value=%v loads=%v", v, loads)
+	}
+	values, err = g.GetManyContext(ctx, []string{"peer-a", "peer-batch"})
+	if !errors.Is(err, ErrNotFound) || len(values) != 0 || loads["peer-batch"] != 0 {
+		t.Fatalf("get many from peer values=%v err=%v loads=%v", values, err, loads)
+	}
+	if v, ok := g.hotCache.get("peer-batch"); !ok || !v.notFound {
+		t.Fatalf("peer negative value not cached in batch, value=%v", v)
+	}
+	// 远程节点没有缓存空值时也返回ErrNotFound，不从本地加载
+	peer.notFound, peer.uncached = false, true
+	values, err = g.GetManyContext(ctx, []string{"peer-uncached"})
+	if !errors.Is(err, ErrNotFound) || len(values) != 0 || loads["peer-uncached"] != 0 {
+		t.Fatalf("get many uncached values=%v err=%v loads=%v", values, err, loads)
+	}
+	if _, ok := g.hotCache.get("peer-uncached"); ok {
+		t.Fatalf("peer uncached negative value should not be cached")
+	}
+}
@@ -0,0 +1,237 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/jiaxwu/gcache/gcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// 批量获取时每次返回的最大字节数，避免超过gRPC消息大小限制
+	maxBatchChunkBytes = 1 << 20
+)
+
+// GRPCPool 基于gRPC实现的伙伴节点
+type GRPCPool struct {
+	// 同伴节点，self为监听地址，比如example.net:8080
+	peerSet
+	// 连接远程节点的选项
+	dialOpts []grpc.DialOption
+}
+
+// NewGRPCPool 创建一个GRPCPool
+// 默认不使用TLS连接远程节点，可以通过opts覆盖
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	p := &GRPCPool{
+		dialOpts: append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...),
+	}
+	p.self = self
+	p.newGetter = func(peer string) PeerGetter {
+		return &grpcGetter{addr: peer, dialOpts: p.dialOpts}
+	}
+	return p
+}
+
+// RegisterServer 把GroupCache服务注册到gRPC服务器
+func (p *GRPCPool) RegisterServer(s grpc.ServiceRegistrar) {
+	pb.RegisterGroupCacheServer(s, &grpcServer{pool: p})
+}
+
+// 处理所有gRPC请求
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+func (s *grpcServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	s.pool.log().Debug("serve grpc", "server", s.pool.self, "op", "Get", "group", in.GetGroup(), "key", in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	res, err := group.serveGet(ctx, in.GetKey())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return res, nil
+}
+
+func (s *grpcServer) Remove(ctx context.Context, in *pb.Request) (*emptypb.Empty, error) {
+	s.pool.log().Debug("serve grpc", "server", s.pool.self, "op", "Remove", "group", in.GetGroup(), "key", in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.removeLocally(in.GetKey())
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, in *pb.SetRequest) (*emptypb.Empty, error) {
+	s.pool.log().Debug("serve grpc", "server", s.pool.self, "op", "Set", "group", in.GetGroup(), "key", in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.setLocally(in.GetKey(), NewByteView(in.GetValue(), fromExpireNano(in.GetExpire())))
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) GetMany(in *pb.BatchRequest, stream pb.GroupCache_GetManyServer) error {
+	s.pool.log().Debug("serve grpc", "server", s.pool.self, "op", "GetMany", "group", in.GetGroup(), "keys", len(in.GetKeys()))
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	res, err := group.serveGetMany(stream.Context(), in.GetKeys())
+	if err != nil {
+		return grpcError(err)
+	}
+	// 分多次返回，每次不超过maxBatchChunkBytes
+	out := &pb.BatchResponse{Values: make(map[string]*pb.Response)}
+	var size int
+	for key, value := range res.Values {
+		out.Values[key] = value
+		size += len(key) + proto.Size(value)
+		if size >= maxBatchChunkBytes {
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+			out = &pb.BatchResponse{Values: make(map[string]*pb.Response)}
+			size = 0
+		}
+	}
+	if len(out.Values) > 0 {
+		return stream.Send(out)
+	}
+	return nil
+}
+
+func (s *grpcServer) group(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+name)
+	}
+	return group, nil
+}
+
+// 转换为gRPC错误，保留ctx的超时和取消
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// 远程节点请求客户端，每个远程节点一个，复用同一个连接
+type grpcGetter struct {
+	addr     string
+	dialOpts []grpc.DialOption
+	// 第一次请求时建立连接
+	mu     sync.Mutex
+	conn   *grpc.ClientConn
+	client pb.GroupCacheClient
+}
+
+func (g *grpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *grpcGetter) Remove(in *pb.Request) error {
+	return g.RemoveContext(context.Background(), in)
+}
+
+func (g *grpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	client, err := g.getClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Get(ctx, in)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) RemoveContext(ctx context.Context, in *pb.Request) error {
+	client, err := g.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.Remove(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) SetContext(ctx context.Context, in *pb.SetRequest) error {
+	client, err := g.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) GetManyContext(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	client, err := g.getClient()
+	if err != nil {
+		return err
+	}
+	stream, err := client.GetMany(ctx, in)
+	if err != nil {
+		return err
+	}
+	if out.Values == nil {
+		out.Values = make(map[string]*pb.Response, len(in.GetKeys()))
+	}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for key, value := range res.Values {
+			out.Values[key] = value
+		}
+	}
+}
+
+// Close 关闭连接
+func (g *grpcGetter) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn, g.client = nil, nil
+	return err
+}
+
+func (g *grpcGetter) getClient() (pb.GroupCacheClient, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client != nil {
+		return g.client, nil
+	}
+	conn, err := grpc.Dial(g.addr, g.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	g.conn, g.client = conn, pb.NewGroupCacheClient(conn)
+	return g.client, nil
+}
@@ -0,0 +1,116 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 启动使用bufconn监听的gRPC服务器，返回连接它的GRPCPool
+func newBufconnPool(t *testing.T) *GRPCPool {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	NewGRPCPool("bufnet").RegisterServer(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	pool := NewGRPCPool("self", grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	pool.Set("bufnet")
+	t.Cleanup(func() { pool.Set() })
+	return pool
+}
+
+func TestGRPCPool(t *testing.T) {
+	g := NewGroup("grpc", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		switch key {
+		case "unknown":
+			return ByteView{}, errors.New("not found")
+		case "missing":
+			return ByteView{}, ErrNotFound
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	pool := newBufconnPool(t)
+	peer, ok := pool.PickPeer("key")
+	if !ok {
+		t.Fatalf("key should belong to remote peer")
+	}
+	ctx := context.Background()
+
+	var res pb.Response
+	if err := peer.GetContext(ctx, &pb.Request{Group: "grpc", Key: "key"}, &res); err != nil || string(res.Value) != "key" {
+		t.Fatalf("get over grpc failed, value=%s err=%v", res.Value, err)
+	}
+	if err := peer.GetContext(ctx, &pb.Request{Group: "grpc", Key: "unknown"}, &res); status.Code(err) != codes.Internal {
+		t.Fatalf("get unknown key should fail, err=%v", err)
+	}
+	if err := peer.GetContext(ctx, &pb.Request{Group: "none", Key: "key"}, &res); status.Code(err) != codes.NotFound {
+		t.Fatalf("get from unknown group should fail, err=%v", err)
+	}
+
+	if err := peer.SetContext(ctx, &pb.SetRequest{Group: "grpc", Key: "key", Value: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	if view, ok := g.mainCache.get("key"); !ok || view.String() != "new" {
+		t.Fatalf("set over grpc failed, value=%s", view)
+	}
+	if err := peer.RemoveContext(ctx, &pb.Request{Group: "grpc", Key: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("key"); ok {
+		t.Fatalf("remove over grpc failed")
+	}
+
+	var batch pb.BatchResponse
+	in := &pb.BatchRequest{Group: "grpc", Keys: []string{"k1", "k2", "unknown", "missing"}}
+	if err := peer.GetManyContext(ctx, in, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Values) != 3 || string(batch.Values["k1"].Value) != "k1" || string(batch.Values["k2"].Value) != "k2" {
+		t.Fatalf("get many over grpc failed, values=%v", batch.Values)
+	}
+	// 不存在的key返回NotFound
+	if res := batch.Values["missing"]; !res.GetNotFound() || res.GetExpire() != 0 {
+		t.Fatalf("missing key over grpc, response=%v", res)
+	}
+}
+
+func TestGRPCPool_Deadline(t *testing.T) {
+	loaded := make(chan error, 1)
+	NewGroup("grpc-deadline", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			loaded <- errors.New("deadline not propagated")
+			return ByteView{}, nil
+		}
+		<-ctx.Done()
+		loaded <- nil
+		return ByteView{}, ctx.Err()
+	}))
+	pool := newBufconnPool(t)
+	peer, _ := pool.PickPeer("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := peer.GetContext(ctx, &pb.Request{Group: "grpc-deadline", Key: "key"}, &pb.Response{})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("get should exceed deadline, err=%v", err)
+	}
+	select {
+	case err := <-loaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("peer kept loading after caller gave up")
+	}
+}
@@ -1,138 +1,279 @@
 package gcache
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/jiaxwu/gcache/consistenthash"
 	pb "github.com/jiaxwu/gcache/gcachepb"
-	"github.com/jiaxwu/gcache/registry"
 )
 
 const (
 	defaultBasePath = "/_gcache/"
-	// 虚拟节点倍数
-	defaultReplicas = 50
+	// 健康检查路径，在basePath下
+	healthPath = "_health"
+	// 请求剩余超时时间的请求头，单位毫秒
+	timeoutHeader = "X-Gcache-Timeout"
+	// 每个远程节点最多保持的空闲连接数
+	defaultMaxIdleConnsPerHost = 64
+	// TCP keep-alive间隔
+	defaultKeepAlive = 30 * time.Second
 )
 
+// HTTPPoolOptions HTTPPool的配置，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// 基础路径，默认"/_gcache/"
+	BasePath string
+	// 一致性哈希的虚拟节点倍数，默认50
+	Replicas int
+	// 请求远程节点使用的Transport，设置后忽略MaxIdleConnsPerHost和KeepAlive
+	Transport http.RoundTripper
+	// 每次请求远程节点的超时时间，默认只使用调用方ctx的截止时间
+	Timeout time.Duration
+	// 每个远程节点最多保持的空闲连接数，默认64
+	MaxIdleConnsPerHost int
+	// TCP keep-alive间隔，默认30s，小于0时关闭
+	KeepAlive time.Duration
+	// 连续失败多少次后熔断，默认5
+	BreakerThreshold int
+	// 熔断后多久允许一次试探请求，默认10s
+	BreakerCooldown time.Duration
+	// 设置后节点之间使用双向TLS通信，Certificates为本节点证书，RootCAs用于验证其他节点的证书
+	// 服务端需要使用ServerTLSConfig，设置Transport时需要自己配置客户端TLS
+	TLSConfig *tls.Config
+	// 设置后对节点之间的请求使用HMAC签名，使用第一个密钥签名，任意一个密钥验证通过即可
+	// 轮换密钥时先在所有节点加入新密钥，再把新密钥移到第一个，最后删除旧密钥
+	Secrets [][]byte
+	// 签名时间戳和本地时间最多相差多久，默认1分钟
+	SignatureWindow time.Duration
+}
+
 // HTTPPool 实现了伙伴节点
 type HTTPPool struct {
-	// 监听地址，比如https://example.net:8080
-	self string
+	// 同伴节点，self为监听地址，比如https://example.net:8080
+	peerSet
 	// 基础路径，避免冲突，比如"/_gcache/"
 	basePath string
-	// 保证设置同伴节点安全
-	mu          sync.RWMutex
-	peers       *consistenthash.Map
-	httpGetters map[string]*httpGetter
+	// 所有远程节点共用的客户端，复用连接池
+	client *http.Client
+	// 每次请求的超时时间
+	timeout time.Duration
+	// 为nil时不使用TLS
+	tlsConfig *tls.Config
+	// 为nil时不签名
+	signer *signer
+	// 熔断器配置
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	// 健康检查
+	healthMu   sync.Mutex
+	healthStop chan struct{}
+	healthDone chan struct{}
 }
 
-// NewHTTPPool 创建一个HTTPPool
+// NewHTTPPool 使用默认配置创建一个HTTPPool
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 创建一个HTTPPool，opts为nil时使用默认配置
+func NewHTTPPoolOpts(self string, opts *HTTPPoolOptions) *HTTPPool {
+	if opts == nil {
+		opts = &HTTPPoolOptions{}
+	}
+	p := &HTTPPool{
+		basePath:         opts.BasePath,
+		client:           &http.Client{Transport: newTransport(opts)},
+		timeout:          opts.Timeout,
+		tlsConfig:        opts.TLSConfig,
+		breakerThreshold: opts.BreakerThreshold,
+		breakerCooldown:  opts.BreakerCooldown,
+	}
+	if p.basePath == "" {
+		p.basePath = defaultBasePath
+	}
+	if !strings.HasSuffix(p.basePath, "/") {
+		p.basePath += "/"
+	}
+	if p.breakerThreshold <= 0 {
+		p.breakerThreshold = defaultBreakerThreshold
+	}
+	if p.breakerCooldown <= 0 {
+		p.breakerCooldown = defaultBreakerCooldown
 	}
+	if len(opts.Secrets) > 0 {
+		p.signer = newSigner(opts.SignatureWindow, opts.Secrets...)
+	}
+	p.self = self
+	p.replicas = opts.Replicas
+	p.newGetter = func(peer string) PeerGetter {
+		return &httpGetter{
+			baseURL: peer + p.basePath,
+			client:  p.client,
+			timeout: p.timeout,
+			signer:  p.signer,
+			breaker: newBreaker(p.breakerThreshold, p.breakerCooldown),
+		}
+	}
+	return p
 }
 
-func (p *HTTPPool) Log(format string, v ...any) {
-	log.Printf("[Server %s] %s\n", p.self, fmt.Sprintf(format, v...))
+// 根据配置创建Transport
+func newTransport(opts *HTTPPoolOptions) http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+	maxIdleConnsPerHost := opts.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: keepAlive,
+	}).DialContext
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.DisableKeepAlives = keepAlive < 0
+	if opts.TLSConfig != nil {
+		// 远程节点证书按照URL中的主机名验证
+		transport.TLSClientConfig = opts.TLSConfig.Clone()
+	}
+	return transport
 }
 
-// SetETCDRegistry 设置etcd名字服务
-func (p *HTTPPool) SetETCDRegistry(ctx context.Context, etcdAddrs ...string) error {
-	p.mu.Lock()
-	r, err := registry.New("gcahce/", etcdAddrs)
-	if err != nil {
-		return err
+// ServerTLSConfig 获取服务端的TLS配置，要求并验证客户端证书，用于http.Server
+// ClientCAs为nil时使用RootCAs验证客户端证书
+func (p *HTTPPool) ServerTLSConfig() *tls.Config {
+	if p.tlsConfig == nil {
+		panic("HTTPPool TLSConfig is not set")
 	}
-	// 注册自己
-	if err := r.Register(ctx, p.self); err != nil {
-		return err
+	config := p.tlsConfig.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if config.ClientCAs == nil {
+		config.ClientCAs = config.RootCAs
 	}
-	// 监听服务变化
-	watch := r.Watch(ctx)
-	// 拉取所有同伴
-	peers, err := r.GetAddrs(ctx)
-	if err != nil {
-		return err
+	return config
+}
+
+// 验证请求方是否为已注册的节点，证书需要包含某个节点地址的主机名
+func (p *HTTPPool) verifyPeer(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return errors.New("client certificate required")
+	}
+	cert := r.TLS.PeerCertificates[0]
+	for _, addr := range p.addrs() {
+		u, err := url.Parse(addr)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		if cert.VerifyHostname(u.Hostname()) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate %q is not a registered peer", cert.Subject.CommonName)
+}
+
+// SetSecrets 更新请求签名的密钥，使用第一个密钥签名，任意一个密钥验证通过即可
+// 创建时没有设置Secrets的话需要在设置同伴节点之前调用
+func (p *HTTPPool) SetSecrets(secrets ...[]byte) {
+	if p.signer == nil {
+		p.signer = newSigner(0, secrets...)
+		return
+	}
+	p.signer.setSecrets(secrets...)
+}
+
+// SetBreaker 设置远程节点的熔断器，需要在设置同伴节点之前调用
+// 连续失败threshold次后熔断，熔断期间请求该节点直接返回ErrPeerUnavailable，cooldown后允许一次试探请求
+// 熔断的节点仍然由PickPeer和GetAll返回，不改变key的拥有者
+func (p *HTTPPool) SetBreaker(threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		panic("breaker threshold must be greater than 0")
+	}
+	p.breakerThreshold = threshold
+	p.breakerCooldown = cooldown
+}
+
+// StartHealthCheck 每隔interval主动检查所有远程节点的健康状态
+// 检查失败计入熔断器的失败次数，成功时恢复熔断的节点
+func (p *HTTPPool) StartHealthCheck(interval time.Duration) {
+	if interval <= 0 {
+		panic("health check interval must be greater than 0")
 	}
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	if p.healthStop != nil {
+		return
 	}
-	p.mu.Unlock()
-	// 根据服务变化进行更新
+	stop, done := make(chan struct{}), make(chan struct{})
+	p.healthStop, p.healthDone = stop, done
 	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-ctx.Done():
+			case <-ticker.C:
+				p.checkHealth(interval)
+			case <-stop:
 				return
-			case event, ok := <-watch:
-				// 通道已经被关闭
-				if !ok {
-					return
-				}
-				p.mu.Lock()
-				if event.AddAddr != "" {
-					p.peers.Add(event.AddAddr)
-					p.httpGetters[event.AddAddr] = &httpGetter{baseURL: event.AddAddr + p.basePath}
-				} else if event.DeleteAddr != "" {
-					p.peers.Delete(event.DeleteAddr)
-					delete(p.httpGetters, event.AddAddr)
-				}
-				p.mu.Unlock()
 			}
 		}
 	}()
-	return nil
 }
 
-// Set 更新同伴节点
-func (p *HTTPPool) Set(peers ...string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
-	}
-}
-
-// PickPeer 根据键获取对应的远程节点客户端
-func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	peer := p.peers.Get(key)
-	if peer == "" || peer == p.self {
-		return nil, false
+// StopHealthCheck 停止健康检查
+func (p *HTTPPool) StopHealthCheck() {
+	p.healthMu.Lock()
+	stop, done := p.healthStop, p.healthDone
+	p.healthStop, p.healthDone = nil, nil
+	p.healthMu.Unlock()
+	if stop == nil {
+		return
 	}
-	p.Log("Pick peer %s", peer)
-	return p.httpGetters[peer], true
+	close(stop)
+	<-done
 }
 
-// GetAll 获取的远程节点客户端
-func (p *HTTPPool) GetAll() []PeerGetter {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	var getters []PeerGetter
-	for name, getter := range p.httpGetters {
-		if name == p.self {
+// 并发检查所有远程节点
+func (p *HTTPPool) checkHealth(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, getter := range p.GetAll() {
+		h, ok := getter.(*httpGetter)
+		if !ok {
 			continue
 		}
-		getters = append(getters, getter)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			healthy := h.breaker.healthy()
+			if err := h.checkHealth(ctx); err != nil {
+				p.log().Warn("peer health check failed", "server", p.self, "peer", h.baseURL, "err", err)
+			} else if !healthy {
+				p.log().Info("peer recovered", "server", p.self, "peer", h.baseURL)
+			}
+		}()
 	}
-	return getters
+	wg.Wait()
 }
 
 // ServeHTTP 处理所有http请求
@@ -140,7 +281,31 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
+	p.log().Debug("serve http", "server", p.self, "method", r.Method, "path", r.URL.Path)
+	if p.tlsConfig != nil {
+		if err := p.verifyPeer(r); err != nil {
+			p.log().Warn("reject peer", "server", p.self, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if p.signer != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := p.signer.verify(r, body); err != nil {
+			p.log().Warn("reject request", "server", p.self, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.URL.Path[len(p.basePath):] == healthPath {
+		w.Write([]byte("ok"))
+		return
+	}
 	// /<basePath>/<groupName>/<key>
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -148,6 +313,19 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 使用调用方传递过来的剩余超时时间
+	ctx := r.Context()
+	if timeout := r.Header.Get(timeoutHeader); timeout != "" {
+		ms, err := strconv.ParseInt(timeout, 10, 64)
+		if err != nil {
+			http.Error(w, "bad timeout: "+timeout, http.StatusBadRequest)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+
 	groupName, key := parts[0], parts[1]
 	group := GetGroup(groupName)
 	if group == nil {
@@ -155,26 +333,67 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 批量获取键
+	if r.Method == http.MethodPost && key == "" {
+		p.serveGetMany(ctx, w, r, group)
+		return
+	}
+
 	// 删除键
 	if r.Method == http.MethodDelete {
 		group.removeLocally(key)
 		return
 	}
 
+	// 设置键
+	if r.Method == http.MethodPut {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var in pb.SetRequest
+		if err := proto.Unmarshal(body, &in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, NewByteView(in.Value, fromExpireNano(in.Expire)))
+		return
+	}
+
 	// 获取键
-	view, err := group.Get(key)
+	res, err := group.serveGet(ctx, key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var expireNano int64
-	if !view.Expire().IsZero() {
-		expireNano = view.Expire().UnixNano()
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	body, err := proto.Marshal(&pb.Response{
-		Value:  view.ByteSlice(),
-		Expire: expireNano,
-	})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// 处理批量获取请求
+func (p *HTTPPool) serveGetMany(ctx context.Context, w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var in pb.BatchRequest
+	if err := proto.Unmarshal(body, &in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := group.serveGetMany(ctx, in.Keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err = proto.Marshal(out)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -186,10 +405,26 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // 远程节点请求客户端，每个远程节点一个
 type httpGetter struct {
 	baseURL string
+	// 为nil时使用http.DefaultClient
+	client *http.Client
+	// 每次请求的超时时间，为0时只使用ctx的截止时间
+	timeout time.Duration
+	// 为nil时不签名
+	signer *signer
+	// 为nil时不熔断
+	breaker *breaker
 }
 
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	res, err := h.makeRequest(http.MethodGet, in)
+	return h.GetContext(context.Background(), in, out)
+}
+
+func (h *httpGetter) Remove(in *pb.Request) error {
+	return h.RemoveContext(context.Background(), in)
+}
+
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	res, err := h.makeRequest(ctx, http.MethodGet, in.GetGroup(), in.GetKey(), nil)
 	if err != nil {
 		return err
 	}
@@ -207,8 +442,24 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
-func (h *httpGetter) Remove(in *pb.Request) error {
-	res, err := h.makeRequest(http.MethodDelete, in)
+func (h *httpGetter) RemoveContext(ctx context.Context, in *pb.Request) error {
+	res, err := h.makeRequest(ctx, http.MethodDelete, in.GetGroup(), in.GetKey(), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+func (h *httpGetter) SetContext(ctx context.Context, in *pb.SetRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := h.makeRequest(ctx, http.MethodPut, in.GetGroup(), in.GetKey(), body)
 	if err != nil {
 		return err
 	}
@@ -219,16 +470,120 @@ func (h *httpGetter) Remove(in *pb.Request) error {
 	return nil
 }
 
-func (h *httpGetter) makeRequest(method string, in *pb.Request) (*http.Response, error) {
+func (h *httpGetter) GetManyContext(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := h.makeRequest(ctx, http.MethodPost, in.GetGroup(), "", body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	return proto.Unmarshal(body, out)
+}
+
+func (h *httpGetter) makeRequest(ctx context.Context, method, group, key string, body []byte) (*http.Response, error) {
+	// 节点熔断时不发出请求
+	if !h.breaker.allow() {
+		return nil, &unavailableError{peer: h.baseURL, retryAfter: h.breaker.retryAfter()}
+	}
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
-	req, err := http.NewRequest(method, u, nil)
+	// 请求超时时间需要覆盖读取响应体，关闭响应体时才取消
+	reqCtx, cancel := ctx, context.CancelFunc(func() {})
+	if h.timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, h.timeout)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, u, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 把剩余超时时间传给远程节点，使其在调用方放弃后停止加载
+	if deadline, ok := reqCtx.Deadline(); ok {
+		timeout := time.Until(deadline).Milliseconds()
+		if timeout <= 0 {
+			cancel()
+			return nil, context.DeadlineExceeded
+		}
+		req.Header.Set(timeoutHeader, strconv.FormatInt(timeout, 10))
+	}
+	// 超时时间也需要签名，避免被篡改
+	h.signer.sign(req, body)
+	res, err := h.httpClient().Do(req)
+	// 请求超时计入失败，调用方主动放弃不计入
+	h.record(ctx, res, err)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return http.DefaultClient.Do(req)
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+func (h *httpGetter) httpClient() *http.Client {
+	if h.client != nil {
+		return h.client
+	}
+	return http.DefaultClient
+}
+
+// 关闭时取消请求的响应体
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// 检查远程节点是否健康
+func (h *httpGetter) checkHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	h.signer.sign(req, nil)
+	res, err := h.httpClient().Do(req)
+	if err != nil {
+		h.breaker.failure()
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		h.breaker.failure()
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	h.breaker.success()
+	return nil
+}
+
+// 根据请求结果更新熔断器，调用方主动放弃的请求不计入
+func (h *httpGetter) record(ctx context.Context, res *http.Response, err error) {
+	switch {
+	case err != nil:
+		if ctx.Err() == nil {
+			h.breaker.failure()
+		}
+	case res.StatusCode == http.StatusBadGateway || res.StatusCode == http.StatusServiceUnavailable ||
+		res.StatusCode == http.StatusGatewayTimeout:
+		h.breaker.failure()
+	default:
+		h.breaker.success()
+	}
 }
@@ -0,0 +1,490 @@
+package gcache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
+	"github.com/jiaxwu/gcache/registry"
+)
+
+func TestHTTPGetter_Deadline(t *testing.T) {
+	loaded := make(chan error, 1)
+	NewGroup("http-deadline", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			loaded <- errors.New("deadline not propagated")
+			return ByteView{}, nil
+		}
+		<-ctx.Done()
+		loaded <- nil
+		return ByteView{}, ctx.Err()
+	}))
+	pool := NewHTTPPool("")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	pool.self = srv.URL
+	pool.Set(srv.URL)
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "http-deadline", Key: "key"}, &pb.Response{}); err == nil {
+		t.Fatalf("get should fail after deadline")
+	}
+	select {
+	case err := <-loaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("peer kept loading after caller gave up")
+	}
+}
+
+func TestHTTPGetter_Set(t *testing.T) {
+	g := NewGroup("http-set", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return ByteView{}, errors.New("not found")
+	}))
+	pool := NewHTTPPool("")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	expire := time.Now().Add(time.Minute)
+	in := &pb.SetRequest{Group: "http-set", Key: "key", Value: []byte("value"), Expire: expire.UnixNano()}
+	if err := getter.SetContext(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	view, ok := g.mainCache.get("key")
+	if !ok || view.String() != "value" || !view.Expire().Equal(time.Unix(0, expire.UnixNano())) {
+		t.Fatalf("set over http failed, value=%s expire=%v", view, view.Expire())
+	}
+}
+
+func TestHTTPGetter_GetMany(t *testing.T) {
+	NewGroup("http-get-many", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		switch key {
+		case "unknown":
+			return ByteView{}, errors.New("not found")
+		case "missing":
+			return ByteView{}, ErrNotFound
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	pool := NewHTTPPool("")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	var out pb.BatchResponse
+	in := &pb.BatchRequest{Group: "http-get-many", Keys: []string{"k1", "k2", "unknown", "missing"}}
+	if err := getter.GetManyContext(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Values) != 3 || string(out.Values["k1"].Value) != "k1" || string(out.Values["k2"].Value) != "k2" {
+		t.Fatalf("get many over http failed, values=%v", out.Values)
+	}
+	// 不存在的key返回NotFound
+	if res := out.Values["missing"]; !res.GetNotFound() || res.GetExpire() != 0 {
+		t.Fatalf("missing key over http, response=%v", res)
+	}
+}
+
+func TestHTTPGetter_NotFound(t *testing.T) {
+	getter := func(ctx context.Context, key string) (ByteView, error) {
+		return ByteView{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	NewGroup("http-not-found", 2<<10, ContextGetterFunc(getter), WithEmptyWhenError(time.Minute))
+	NewGroup("http-not-found-uncached", 2<<10, ContextGetterFunc(getter))
+	pool := NewHTTPPool("")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	var out pb.Response
+	if err := peer.GetContext(context.Background(), &pb.Request{Group: "http-not-found", Key: "k"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.NotFound || out.Expire == 0 {
+		t.Fatalf("negative value not preserved, response=%v", &out)
+	}
+	out.Reset()
+	if err := peer.GetContext(context.Background(), &pb.Request{Group: "http-not-found-uncached", Key: "k"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.NotFound || out.Expire != 0 {
+		t.Fatalf("uncached not found response=%v", &out)
+	}
+
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 50*time.Millisecond)
+	b.failure()
+	if !b.allow() || !b.healthy() {
+		t.Fatalf("breaker opened before threshold")
+	}
+	b.failure()
+	if b.allow() || b.healthy() {
+		t.Fatalf("breaker should be open after threshold")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !b.allow() {
+		t.Fatalf("breaker should allow a trial after cooldown")
+	}
+	if b.allow() {
+		t.Fatalf("half-open breaker should allow only one trial")
+	}
+	b.failure()
+	if b.allow() {
+		t.Fatalf("failed trial should reopen breaker")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !b.allow() {
+		t.Fatalf("breaker should allow a trial after cooldown")
+	}
+	b.success()
+	if !b.allow() || !b.healthy() {
+		t.Fatalf("successful trial should close breaker")
+	}
+}
+
+func TestHTTPPool_Breaker(t *testing.T) {
+	NewGroup("http-breaker", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	peer := NewHTTPPool("")
+	srv := httptest.NewServer(peer)
+	defer srv.Close()
+
+	pool := NewHTTPPool("self")
+	pool.SetBreaker(1, time.Hour)
+	pool.Set("self", srv.URL)
+	// peerKey属于远程节点，selfKey属于自己，删除selfKey时需要通知远程节点删除副本
+	var peerKey, selfKey string
+	for i := 0; peerKey == "" || selfKey == ""; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			peerKey = strconv.Itoa(i)
+		} else {
+			selfKey = strconv.Itoa(i)
+		}
+	}
+	getter, _ := pool.PickPeer(peerKey)
+	h := getter.(*httpGetter)
+	g := NewGroup("http-breaker-self", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	g.RegisterPeers(pool)
+	if err := h.GetContext(context.Background(), &pb.Request{Group: "http-breaker", Key: peerKey}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 节点不可达时熔断，仍然是key的拥有者，但是请求不再发出
+	srv.Close()
+	if err := h.GetContext(context.Background(), &pb.Request{Group: "http-breaker", Key: peerKey}, &pb.Response{}); err == nil {
+		t.Fatalf("get should fail after peer closed")
+	}
+	if getter, ok := pool.PickPeer(peerKey); !ok || getter != h {
+		t.Fatalf("unhealthy peer should still own the key")
+	}
+	if err := h.GetContext(context.Background(), &pb.Request{Group: "http-breaker", Key: peerKey}, &pb.Response{}); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("get from open peer err=%v, want ErrPeerUnavailable", err)
+	} else if d := retryAfter(err); d <= time.Hour-time.Minute || d > time.Hour {
+		t.Fatalf("retry after %v, want remaining cooldown", d)
+	}
+	// 删除时不能跳过熔断的节点，否则其恢复后仍然返回过时的副本
+	if peers := pool.GetAll(); len(peers) != 1 {
+		t.Fatalf("unhealthy peer should still be fanned out, peers=%v", peers)
+	}
+	if err := g.RemoveContext(context.Background(), selfKey); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("remove with open peer err=%v, want ErrPeerUnavailable", err)
+	}
+
+	// 健康检查成功后恢复
+	srv = httptest.NewServer(peer)
+	defer srv.Close()
+	h.baseURL = srv.URL + defaultBasePath
+	pool.StartHealthCheck(10 * time.Millisecond)
+	defer pool.StopHealthCheck()
+	deadline := time.Now().Add(time.Second)
+	for !h.breaker.healthy() {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer not recovered by health check")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := g.RemoveContext(context.Background(), selfKey); err != nil {
+		t.Fatalf("remove after recovery err=%v", err)
+	}
+}
+
+// 统计请求次数的Transport
+type countingTransport struct {
+	n AtomicInt
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.n.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHTTPPool_Options(t *testing.T) {
+	NewGroup("http-options", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		if key == "slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return ByteView{}, ctx.Err()
+			}
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	transport := &countingTransport{}
+	opts := &HTTPPoolOptions{
+		BasePath:  "/_custom",
+		Replicas:  3,
+		Transport: transport,
+		Timeout:   50 * time.Millisecond,
+	}
+	peer := NewHTTPPoolOpts("", opts)
+	srv := httptest.NewServer(peer)
+	defer srv.Close()
+
+	pool := NewHTTPPoolOpts("self", opts)
+	pool.Set(srv.URL)
+	getter, ok := pool.PickPeer("key")
+	if !ok {
+		t.Fatalf("peer should be picked")
+	}
+	var out pb.Response
+	if err := getter.GetContext(context.Background(), &pb.Request{Group: "http-options", Key: "key"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Value) != "key" || transport.n.Get() != 1 {
+		t.Fatalf("get with options failed, value=%s requests=%d", out.Value, transport.n.Get())
+	}
+	start := time.Now()
+	if err := getter.GetContext(context.Background(), &pb.Request{Group: "http-options", Key: "slow"}, &out); err == nil {
+		t.Fatalf("get should fail after timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("timeout not applied, elapsed=%v", elapsed)
+	}
+}
+
+// 测试用的证书颁发机构
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gcache test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// 签发同时用于服务端和客户端的节点证书
+func (ca *testCA) issue(t *testing.T, name string, ips ...net.IP) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestHTTPPool_MutualTLS(t *testing.T) {
+	NewGroup("http-mtls", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	ca := newTestCA(t)
+	localhost := net.ParseIP("127.0.0.1")
+	tlsConfig := func(cert tls.Certificate) *HTTPPoolOptions {
+		return &HTTPPoolOptions{TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: ca.pool}}
+	}
+	server := NewHTTPPoolOpts("", tlsConfig(ca.issue(t, "peer", localhost)))
+	srv := httptest.NewUnstartedServer(server)
+	srv.TLS = server.ServerTLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+	server.self = srv.URL
+	server.Set(srv.URL)
+
+	get := func(pool *HTTPPool) error {
+		pool.Set(srv.URL)
+		getter, ok := pool.PickPeer("key")
+		if !ok {
+			t.Fatalf("peer should be picked")
+		}
+		var out pb.Response
+		if err := getter.GetContext(context.Background(), &pb.Request{Group: "http-mtls", Key: "key"}, &out); err != nil {
+			return err
+		}
+		if string(out.Value) != "key" {
+			t.Fatalf("get over mtls failed, value=%s", out.Value)
+		}
+		return nil
+	}
+	// 已注册节点的证书
+	if err := get(NewHTTPPoolOpts("self", tlsConfig(ca.issue(t, "peer", localhost)))); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个CA签发但不属于任何已注册节点的证书
+	if err := get(NewHTTPPoolOpts("self", tlsConfig(ca.issue(t, "rogue.example")))); err == nil {
+		t.Fatalf("unregistered peer should be rejected")
+	}
+	// 没有客户端证书
+	if err := get(NewHTTPPoolOpts("self", &HTTPPoolOptions{TLSConfig: &tls.Config{RootCAs: ca.pool}})); err == nil {
+		t.Fatalf("peer without certificate should be rejected")
+	}
+	// 其他CA签发的证书
+	if err := get(NewHTTPPoolOpts("self", &HTTPPoolOptions{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{newTestCA(t).issue(t, "peer", localhost)},
+		RootCAs:      ca.pool,
+	}})); err == nil {
+		t.Fatalf("peer signed by unknown ca should be rejected")
+	}
+}
+
+func TestHTTPPool_Discovery(t *testing.T) {
+	d := registry.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := NewHTTPPool("http://a"), NewHTTPPool("http://b")
+	// 设置名字服务后替换原来的节点
+	a.Set("http://stale")
+	if err := a.SetDiscovery(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.GetAll()) != 0 {
+		t.Fatalf("only self registered, peers=%v", a.GetAll())
+	}
+	bCtx, bCancel := context.WithCancel(ctx)
+	if err := b.SetDiscovery(bCtx, d); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.GetAll()) != 1 {
+		t.Fatalf("peer a not discovered, peers=%v", b.GetAll())
+	}
+	waitPeers := func(n int) {
+		deadline := time.Now().Add(time.Second)
+		for len(a.GetAll()) != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %d peers, got %d", n, len(a.GetAll()))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitPeers(1)
+	bCancel()
+	waitPeers(0)
+}
+
+func TestHTTPPool_GossipDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newNode := func(self string) (*HTTPPool, *registry.Gossip) {
+		g, err := registry.NewGossip(&registry.GossipConfig{
+			BindAddr:      "127.0.0.1:0",
+			ProbeInterval: 50 * time.Millisecond,
+			ProbeTimeout:  20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { g.Close() })
+		pool := NewHTTPPool(self)
+		if err := pool.SetDiscovery(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+		return pool, g
+	}
+	a, ga := newNode("http://a")
+	b, gb := newNode("http://b")
+	if err := gb.Join(ga.Name()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.GetAll()) != 1 || len(b.GetAll()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers not discovered by gossip, a=%d b=%d", len(a.GetAll()), len(b.GetAll()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 节点离开后从哈希环中删除
+	gb.Close()
+	for len(a.GetAll()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("left peer not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPPool_AddExisting(t *testing.T) {
+	pool := NewHTTPPool("http://self")
+	pool.add("http://a")
+	getter, ok := pool.PickPeer("key")
+	if !ok {
+		t.Fatalf("peer should be picked")
+	}
+	// 重复添加不重建客户端，也不增加虚拟节点
+	pool.add("http://a")
+	if again, _ := pool.PickPeer("key"); again != getter {
+		t.Fatalf("existing peer getter recreated")
+	}
+	pool.remove("http://a")
+	if _, ok := pool.PickPeer("key"); ok {
+		t.Fatalf("removed peer should not be picked")
+	}
+}
@@ -0,0 +1,113 @@
+package gcache
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger 结构化日志，args为交替出现的key和value
+// *slog.Logger实现了该接口，可以直接使用
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Level 日志级别，取值和slog.Level一致
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// LoggerFunc 把处理函数适配为Logger，可以用于对接slog.Handler等日志库
+type LoggerFunc func(level Level, msg string, args ...any)
+
+func (f LoggerFunc) Debug(msg string, args ...any) {
+	f(LevelDebug, msg, args...)
+}
+
+func (f LoggerFunc) Info(msg string, args ...any) {
+	f(LevelInfo, msg, args...)
+}
+
+func (f LoggerFunc) Warn(msg string, args ...any) {
+	f(LevelWarn, msg, args...)
+}
+
+func (f LoggerFunc) Error(msg string, args ...any) {
+	f(LevelError, msg, args...)
+}
+
+// NewStdLogger 使用标准库log输出minLevel及以上级别的日志，格式为level=INFO msg=xxx key=value
+func NewStdLogger(l *log.Logger, minLevel Level) Logger {
+	return LoggerFunc(func(level Level, msg string, args ...any) {
+		if level < minLevel {
+			return
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "level=%s msg=%q", level, msg)
+		for i := 0; i < len(args); i += 2 {
+			if i+1 == len(args) {
+				fmt.Fprintf(&sb, " !BADKEY=%v", args[i])
+				break
+			}
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		}
+		l.Output(2, sb.String())
+	})
+}
+
+// 不输出任何日志
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// 全局日志，默认不输出
+var defaultLogger atomic.Value
+
+type loggerHolder struct {
+	Logger
+}
+
+func init() {
+	defaultLogger.Store(loggerHolder{nopLogger{}})
+}
+
+// SetLogger 设置全局日志，为nil时不输出日志
+// 没有单独设置日志的Group和Pool使用全局日志
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	defaultLogger.Store(loggerHolder{l})
+}
+
+// 获取全局日志
+func getLogger() Logger {
+	return defaultLogger.Load().(loggerHolder).Logger
+}
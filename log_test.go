@@ -0,0 +1,42 @@
+package gcache
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Debug("debug")
+	l.Info("hit", "group", "scores", "key", "Tom")
+	l.Warn("odd", "key")
+	want := "level=INFO msg=\"hit\" group=scores key=Tom\nlevel=WARN msg=\"odd\" !BADKEY=key\n"
+	if buf.String() != want {
+		t.Fatalf("log output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	var levels []string
+	SetLogger(LoggerFunc(func(level Level, msg string, args ...any) {
+		levels = append(levels, level.String())
+	}))
+	defer SetLogger(nil)
+
+	pool := NewHTTPPool("self")
+	pool.Log("global")
+	var buf bytes.Buffer
+	pool.SetLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug))
+	pool.Log("pool")
+	if strings.Join(levels, ",") != "DEBUG" || !strings.Contains(buf.String(), `msg="pool" server=self`) {
+		t.Fatalf("global logs %v, pool logs %q", levels, buf.String())
+	}
+
+	g := NewGroup("logger", 1<<10, GetterFunc(nil), WithLogger(nopLogger{}))
+	if _, ok := g.log().(nopLogger); !ok {
+		t.Fatalf("group logger is %T", g.log())
+	}
+}
@@ -0,0 +1,66 @@
+package lru
+
+import (
+	"time"
+
+	"github.com/jiaxwu/gcache/zset"
+)
+
+// ExpireIndex 过期键索引，用于找出已经过期的键
+type ExpireIndex interface {
+	// Set 设置key的过期时间
+	Set(key string, expire time.Time)
+	// Remove 删除key
+	Remove(key string)
+	// Expired 返回最多n个在now之前已经过期的key，不会从索引中删除
+	Expired(now time.Time, n int) []string
+	// Len 返回key的数量
+	Len() int
+}
+
+// Option Cache的可选配置
+type Option func(c *Cache)
+
+// WithExpireIndex 设置过期键索引，默认使用ZSet
+func WithExpireIndex(index ExpireIndex) Option {
+	return func(c *Cache) {
+		c.expires = index
+	}
+}
+
+// 基于ZSet的过期键索引，插入和删除的时间复杂度为O(logn)
+type zsetIndex struct {
+	zset *zset.SortedSet
+}
+
+// NewZSetIndex 创建基于ZSet的过期键索引
+func NewZSetIndex() ExpireIndex {
+	return &zsetIndex{zset: zset.New()}
+}
+
+func (z *zsetIndex) Set(key string, expire time.Time) {
+	z.zset.ZAdd(expiresZSetKey, expire.UnixNano(), key)
+}
+
+func (z *zsetIndex) Remove(key string) {
+	z.zset.ZRem(expiresZSetKey, key)
+}
+
+func (z *zsetIndex) Expired(now time.Time, n int) []string {
+	var keys []string
+	nowNano := now.UnixNano()
+	values := z.zset.ZRangeWithScores(expiresZSetKey, 0, n-1)
+	for i := 0; i < len(values); i += 2 {
+		key, expireNano := values[i].(string), values[i+1].(int64)
+		// 后面的键都没过期
+		if expireNano > nowNano {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (z *zsetIndex) Len() int {
+	return z.zset.ZCard(expiresZSetKey)
+}
@@ -0,0 +1,168 @@
+package lru
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// late为索引的时间精度，键最多晚late被返回
+func testExpireIndex(t *testing.T, index ExpireIndex, late time.Duration) {
+	now := time.Now()
+	// 覆盖时间轮的每一层以及超过最大范围的情况
+	offsets := []time.Duration{
+		-time.Second, 0, time.Millisecond * 500, time.Second, time.Minute, time.Hour, 30 * time.Hour, 1000 * time.Hour,
+	}
+	for i, offset := range offsets {
+		index.Set(strconv.Itoa(i), now.Add(offset))
+	}
+	// 重新设置过期时间
+	index.Set("0", now.Add(time.Minute))
+	index.Set("removed", now)
+	index.Remove("removed")
+	if index.Len() != len(offsets) {
+		t.Fatalf("len=%d, want %d", index.Len(), len(offsets))
+	}
+	expired := func(at time.Duration) []string {
+		keys := index.Expired(now.Add(at+late), 100)
+		sort.Strings(keys)
+		return keys
+	}
+	for _, c := range []struct {
+		at   time.Duration
+		want []string
+	}{
+		{0, []string{"1"}},
+		{time.Second, []string{"1", "2", "3"}},
+		{time.Minute + time.Second, []string{"0", "1", "2", "3", "4"}},
+		{time.Hour + time.Second, []string{"0", "1", "2", "3", "4", "5"}},
+		{31 * time.Hour, []string{"0", "1", "2", "3", "4", "5", "6"}},
+		{1001 * time.Hour, []string{"0", "1", "2", "3", "4", "5", "6", "7"}},
+	} {
+		if keys := expired(c.at); strings.Join(keys, ",") != strings.Join(c.want, ",") {
+			t.Fatalf("expired at +%v: %v, want %v", c.at, keys, c.want)
+		}
+	}
+	if keys := index.Expired(now.Add(1001*time.Hour), 3); len(keys) != 3 {
+		t.Fatalf("expired returned %d keys, want 3", len(keys))
+	}
+	for i := range offsets {
+		index.Remove(strconv.Itoa(i))
+	}
+	if index.Len() != 0 || len(index.Expired(now.Add(1001*time.Hour), 100)) != 0 {
+		t.Fatalf("index not empty after remove, len=%d", index.Len())
+	}
+}
+
+func TestZSetIndex(t *testing.T) {
+	testExpireIndex(t, NewZSetIndex(), 0)
+}
+
+func TestTimingWheel(t *testing.T) {
+	testExpireIndex(t, NewTimingWheel(100*time.Millisecond), 100*time.Millisecond)
+}
+
+// 长时间没有调用时直接跳到下一个需要处理的tick，不逐个tick推进
+func TestTimingWheel_IdleGap(t *testing.T) {
+	w := NewTimingWheel(time.Millisecond)
+	// 对齐到tick，避免取整的影响
+	base := time.Now().Truncate(time.Millisecond).Add(time.Millisecond)
+	r := rand.New(rand.NewSource(1))
+	offsets := make(map[string]time.Duration)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		offsets[key] = time.Duration(r.Int63n(int64(2000*time.Hour/time.Millisecond))) * time.Millisecond
+		w.Set(key, base.Add(offsets[key]))
+	}
+	start := time.Now()
+	for _, at := range []time.Duration{time.Minute, time.Hour, 100 * time.Hour, 1000 * time.Hour, 2000 * time.Hour} {
+		var want []string
+		for key, offset := range offsets {
+			if offset <= at {
+				want = append(want, key)
+			}
+		}
+		keys := w.Expired(base.Add(at), len(offsets))
+		sort.Strings(want)
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, want) {
+			t.Fatalf("expired at +%v: %d keys, want %d", at, len(keys), len(want))
+		}
+	}
+	// 逐个tick推进需要处理7.2e9个tick
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("advance across idle gap took %v", d)
+	}
+}
+
+func TestCache_TimingWheel(t *testing.T) {
+	lru := New(0, nil, WithExpireIndex(NewTimingWheel(time.Millisecond)))
+	lru.Add("key1", &String{s: "value1", expire: time.Now().Add(20 * time.Millisecond)})
+	lru.Add("key2", &String{s: "value2", expire: time.Now().Add(time.Hour)})
+	lru.Add("key3", &String{s: "value3"})
+	time.Sleep(50 * time.Millisecond)
+	if removed := lru.ExpireCycle(0); removed != 1 || lru.Len() != 2 {
+		t.Fatalf("expire cycle removed %d keys, len=%d", removed, lru.Len())
+	}
+	// 覆盖为不过期后从索引中删除
+	lru.Add("key2", &String{s: "value2"})
+	if lru.expires.Len() != 0 {
+		t.Fatalf("expire index len=%d, want 0", lru.expires.Len())
+	}
+}
+
+// go test -run=^$ -bench=BenchmarkExpireIndex -benchmem
+func BenchmarkExpireIndex_Set(b *testing.B) {
+	benchmarkExpireIndex(b, func(b *testing.B, newIndex func() ExpireIndex) {
+		index := newIndex()
+		keys := benchmarkKeys(b.N)
+		now := time.Now()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			index.Set(keys[i], now.Add(time.Duration(i%3600)*time.Second))
+		}
+	})
+}
+
+func BenchmarkExpireIndex_Expire(b *testing.B) {
+	benchmarkExpireIndex(b, func(b *testing.B, newIndex func() ExpireIndex) {
+		index := newIndex()
+		keys := benchmarkKeys(b.N)
+		now := time.Now()
+		for i := 0; i < b.N; i++ {
+			index.Set(keys[i], now.Add(time.Duration(i%1000)*time.Millisecond))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		// 每次取出一批过期键并删除
+		at := now.Add(2 * time.Second)
+		for removed := 0; removed < b.N; {
+			for _, key := range index.Expired(at, removeExpireN) {
+				index.Remove(key)
+				removed++
+			}
+		}
+	})
+}
+
+func benchmarkExpireIndex(b *testing.B, run func(b *testing.B, newIndex func() ExpireIndex)) {
+	b.Run("zset", func(b *testing.B) {
+		run(b, NewZSetIndex)
+	})
+	b.Run("timingwheel", func(b *testing.B) {
+		run(b, func() ExpireIndex { return NewTimingWheel(0) })
+	})
+}
+
+func benchmarkKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}
@@ -0,0 +1,102 @@
+package lru
+
+import (
+	"sync"
+	"time"
+)
+
+// 主动删除过期键，参考Redis的activeExpireCycle
+// https://github.com/redis/redis/blob/7.0/src/expire.c
+
+const (
+	// 每轮采样的过期键数量
+	expireCycleSamples = 20
+	// 采样中过期键的比例超过该值时继续下一轮
+	expireCycleAcceptablePercent = 25
+	// 每多少轮检查一次是否超时
+	expireCycleCheckEvery = 16
+)
+
+// ExpireCycle 主动删除过期的键
+// 每轮从expires中采样一批键并删除其中已经过期的，过期比例较高时继续下一轮，
+// 总耗时不超过timeLimit，为0表示不限制
+// 返回删除的键数量
+func (c *Cache) ExpireCycle(timeLimit time.Duration) int {
+	start := time.Now()
+	var removed int
+	for iteration := 1; ; iteration++ {
+		sampled := c.expires.Len()
+		if sampled > expireCycleSamples {
+			sampled = expireCycleSamples
+		}
+		if sampled == 0 {
+			break
+		}
+		keys := c.expires.Expired(time.Now(), expireCycleSamples)
+		for _, key := range keys {
+			c.Remove(key)
+		}
+		expired := len(keys)
+		removed += expired
+		if expired*100 <= sampled*expireCycleAcceptablePercent {
+			break
+		}
+		if timeLimit > 0 && iteration%expireCycleCheckEvery == 0 && time.Since(start) > timeLimit {
+			break
+		}
+	}
+	return removed
+}
+
+// 后台清理协程
+type janitor struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartJanitor 启动后台清理协程，每隔interval执行一次ExpireCycle，每次最多执行timeLimit
+// Cache不是并发安全的，清理时会持有mu，mu需要和其他操作使用的锁相同
+// 已经启动时不做任何操作
+func (c *Cache) StartJanitor(mu sync.Locker, interval, timeLimit time.Duration) {
+	if interval <= 0 {
+		panic("janitor interval must be greater than 0")
+	}
+	c.janitorMu.Lock()
+	defer c.janitorMu.Unlock()
+	if c.janitor != nil {
+		return
+	}
+	j := &janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	c.janitor = j
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				c.ExpireCycle(timeLimit)
+				mu.Unlock()
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopJanitor 停止后台清理协程并等待其退出，调用时不能持有StartJanitor的mu
+func (c *Cache) StopJanitor() {
+	c.janitorMu.Lock()
+	j := c.janitor
+	c.janitor = nil
+	c.janitorMu.Unlock()
+	if j == nil {
+		return
+	}
+	close(j.stop)
+	<-j.done
+}
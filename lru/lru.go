@@ -2,7 +2,7 @@ package lru
 
 import (
 	"container/list"
-	"github.com/jiaxwu/gcache/zset"
+	"sync"
 	"time"
 )
 
@@ -26,8 +26,11 @@ type Cache struct {
 	cache  map[string]*list.Element
 	// 可选，在entry被移除的时候执行
 	onEvicted func(key string, value Value)
-	// 过期键集合
-	expires *zset.SortedSet
+	// 过期键索引
+	expires ExpireIndex
+	// 后台清理过期键
+	janitorMu sync.Mutex
+	janitor   *janitor
 }
 
 type entry struct {
@@ -41,14 +44,20 @@ type Value interface {
 	Expire() time.Time
 }
 
-func New(maxBytes int, onEvicted func(key string, value Value)) *Cache {
-	return &Cache{
+func New(maxBytes int, onEvicted func(key string, value Value), opts ...Option) *Cache {
+	c := &Cache{
 		maxBytes:  maxBytes,
 		ll:        list.New(),
 		cache:     make(map[string]*list.Element),
 		onEvicted: onEvicted,
-		expires:   zset.New(),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.expires == nil {
+		c.expires = NewZSetIndex()
+	}
+	return c
 }
 
 // Get 获取缓存的值
@@ -85,10 +94,10 @@ func (c *Cache) Add(key string, value Value) {
 	}
 	// 如果有超时时间则设置
 	if !value.Expire().IsZero() {
-		c.expires.ZAdd(expiresZSetKey, value.Expire().UnixNano(), key)
+		c.expires.Set(key, value.Expire())
 	} else {
 		// 没有则删除
-		c.expires.ZRem(expiresZSetKey, key)
+		c.expires.Remove(key)
 	}
 	// 淘汰过期的key
 	for c.maxBytes != 0 && c.nBytes > c.maxBytes {
@@ -115,6 +124,11 @@ func (c *Cache) Len() int {
 	return c.ll.Len()
 }
 
+// Bytes 返回已经缓存的字节数
+func (c *Cache) Bytes() int {
+	return c.nBytes
+}
+
 // 移除最近最少访问的数据
 func (c *Cache) removeOldest() {
 	front := c.ll.Front()
@@ -131,7 +145,7 @@ func (c *Cache) removeElement(e *list.Element) {
 	c.nBytes -= len(kv.key) + kv.value.Len()
 	// 移除过期键
 	if !kv.value.Expire().IsZero() {
-		c.expires.ZRem(expiresZSetKey, kv.key)
+		c.expires.Remove(kv.key)
 	}
 	if c.onEvicted != nil {
 		c.onEvicted(kv.key, kv.value)
@@ -141,13 +155,7 @@ func (c *Cache) removeElement(e *list.Element) {
 // 移除过期的键
 // 返回未删除的数量
 func (c *Cache) removeExpire(n int) int {
-	for n > 0 && c.expires.ZCard(expiresZSetKey) > 0 {
-		values := c.expires.ZRangeWithScores(expiresZSetKey, 0, 0)
-		key, expireNano := values[0].(string), values[1].(int64)
-		// 第一个键都没超时，结果循环
-		if expireNano > time.Now().UnixNano() {
-			break
-		}
+	for _, key := range c.expires.Expired(time.Now(), n) {
 		c.Remove(key)
 		n--
 	}
@@ -1,6 +1,8 @@
 package lru
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -130,3 +132,49 @@ func TestCache_RemoveExpire(t *testing.T) {
 		t.Fatalf("remove expire keys failed, len=%d\n", lru.Len())
 	}
 }
+
+func TestCache_ExpireCycle(t *testing.T) {
+	lru := New(0, nil)
+	expired := time.Now().Add(-time.Second)
+	for i := 0; i < 100; i++ {
+		lru.Add(strconv.Itoa(i), &String{s: "v", expire: expired})
+	}
+	lru.Add("live", &String{s: "v", expire: time.Now().Add(time.Hour)})
+	lru.Add("forever", &String{s: "v"})
+	if removed := lru.ExpireCycle(time.Second); removed != 100 || lru.Len() != 2 {
+		t.Fatalf("expire cycle removed %d keys, len=%d\n", removed, lru.Len())
+	}
+	if removed := lru.ExpireCycle(time.Second); removed != 0 {
+		t.Fatalf("expire cycle removed %d live keys\n", removed)
+	}
+}
+
+func TestCache_Janitor(t *testing.T) {
+	var mu sync.Mutex
+	lru := New(0, nil)
+	mu.Lock()
+	lru.Add("key1", &String{s: "value1", expire: time.Now().Add(50 * time.Millisecond)})
+	lru.Add("key2", &String{s: "value2"})
+	mu.Unlock()
+	lru.StartJanitor(&mu, 10*time.Millisecond, time.Millisecond)
+	lru.StartJanitor(&mu, 10*time.Millisecond, time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if lru.Len() != 1 || lru.Bytes() != len("key2")+len("value2") {
+		t.Fatalf("janitor did not remove expired key, len=%d\n", lru.Len())
+	}
+	mu.Unlock()
+	lru.StopJanitor()
+	lru.StopJanitor()
+
+	// 停止后不再清理
+	mu.Lock()
+	lru.Add("key3", &String{s: "value3", expire: time.Now().Add(10 * time.Millisecond)})
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if lru.Len() != 2 {
+		t.Fatalf("stopped janitor removed key, len=%d\n", lru.Len())
+	}
+}
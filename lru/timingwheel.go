@@ -0,0 +1,217 @@
+package lru
+
+import "time"
+
+// 分层时间轮，插入和删除的时间复杂度为O(1)
+// 每层64个槽，第0层每个槽为一个tick，第i层每个槽为64^i个tick，
+// 时间推进到高层槽的起点时，把槽中的键重新放入低层，到达第0层的槽时过期
+// http://www.cs.columbia.edu/~nahum/w6998/papers/sosp87-timing-wheels.pdf
+
+const (
+	wheelBits   = 6
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 4
+	// 时间轮能表示的最大tick数，超过的键先放到最高层，之后再重新放置
+	wheelMaxTicks = 1 << (wheelBits * wheelLevels)
+	// 默认每个tick的时间
+	defaultWheelTick = 10 * time.Millisecond
+)
+
+// TimingWheel 基于分层时间轮的过期键索引
+// 键的过期时间向上取整到tick，最多比实际过期时间晚一个tick被返回
+type TimingWheel struct {
+	tick int64
+	// 下一个要处理的tick
+	clk     int64
+	slots   [wheelLevels][wheelSize]wheelList
+	entries map[string]*wheelEntry
+	// 已经过期的键
+	due wheelList
+	// 在时间轮中还没过期的键数量
+	pending int
+}
+
+type wheelEntry struct {
+	key string
+	// 过期的tick
+	expire     int64
+	prev, next *wheelEntry
+	list       *wheelList
+}
+
+// 双向链表
+type wheelList struct {
+	head *wheelEntry
+	tail *wheelEntry
+}
+
+func (l *wheelList) pushBack(e *wheelEntry) {
+	e.list, e.prev, e.next = l, l.tail, nil
+	if l.tail == nil {
+		l.head = e
+	} else {
+		l.tail.next = e
+	}
+	l.tail = e
+}
+
+func (l *wheelList) remove(e *wheelEntry) {
+	if e.prev == nil {
+		l.head = e.next
+	} else {
+		e.prev.next = e.next
+	}
+	if e.next == nil {
+		l.tail = e.prev
+	} else {
+		e.next.prev = e.prev
+	}
+	e.list, e.prev, e.next = nil, nil, nil
+}
+
+// NewTimingWheel 创建分层时间轮，tick为时间精度，小于等于0时使用默认值10ms
+func NewTimingWheel(tick time.Duration) *TimingWheel {
+	if tick <= 0 {
+		tick = defaultWheelTick
+	}
+	w := &TimingWheel{
+		tick:    int64(tick),
+		entries: make(map[string]*wheelEntry),
+	}
+	w.clk = time.Now().UnixNano() / w.tick
+	return w
+}
+
+func (w *TimingWheel) Set(key string, expire time.Time) {
+	e, ok := w.entries[key]
+	if ok {
+		w.unlink(e)
+	} else {
+		e = &wheelEntry{key: key}
+		w.entries[key] = e
+	}
+	// 向上取整，保证处理到该tick时已经过期
+	nano := expire.UnixNano()
+	e.expire = nano / w.tick
+	if nano%w.tick > 0 {
+		e.expire++
+	}
+	w.place(e)
+}
+
+func (w *TimingWheel) Remove(key string) {
+	if e, ok := w.entries[key]; ok {
+		w.unlink(e)
+		delete(w.entries, key)
+	}
+}
+
+func (w *TimingWheel) Expired(now time.Time, n int) []string {
+	w.advance(now.UnixNano() / w.tick)
+	var keys []string
+	for e := w.due.head; e != nil && len(keys) < n; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func (w *TimingWheel) Len() int {
+	return len(w.entries)
+}
+
+// 推进时间到now，处理[clk, now]之间的所有tick
+// 没有到期键也不需要重新放置的tick直接跳过，长时间没有调用时不需要逐个tick推进
+func (w *TimingWheel) advance(now int64) {
+	for w.clk <= now {
+		// 时间轮为空时直接跳过
+		if w.pending == 0 {
+			w.clk = now + 1
+			return
+		}
+		if w.slots[0][w.clk&wheelMask].head == nil {
+			if w.clk = w.next(); w.clk > now {
+				w.clk = now + 1
+				return
+			}
+		}
+		// 从高层到低层，把到达起点的槽重新放置
+		for level := wheelLevels - 1; level > 0; level-- {
+			shift := uint(level * wheelBits)
+			if w.clk&(1<<shift-1) == 0 {
+				w.cascade(&w.slots[level][(w.clk>>shift)&wheelMask])
+			}
+		}
+		slot := &w.slots[0][w.clk&wheelMask]
+		for e := slot.head; e != nil; e = slot.head {
+			slot.remove(e)
+			w.pending--
+			w.due.pushBack(e)
+		}
+		w.clk++
+	}
+}
+
+// 从clk开始下一个需要处理的tick，即第0层的非空槽或者需要重新放置的高层非空槽
+// 第i层的槽在tick为64^i的倍数时处理，槽中的键一定在之后64个这样的tick内被处理，
+// 所以每层从下一个处理点开始循环查找第一个非空槽即可，时间轮不能为空
+func (w *TimingWheel) next() int64 {
+	next := int64(-1)
+	for level := 0; level < wheelLevels; level++ {
+		shift := uint(level * wheelBits)
+		unit := int64(1) << shift
+		// 该层的下一个处理点
+		base := (w.clk + unit - 1) >> shift
+		for d := int64(0); d < wheelSize; d++ {
+			at := (base + d) << shift
+			if next >= 0 && at >= next {
+				break
+			}
+			if w.slots[level][(base+d)&wheelMask].head != nil {
+				next = at
+				break
+			}
+		}
+	}
+	return next
+}
+
+// 重新放置槽中的键
+func (w *TimingWheel) cascade(slot *wheelList) {
+	for e := slot.head; e != nil; e = slot.head {
+		slot.remove(e)
+		w.pending--
+		w.place(e)
+	}
+}
+
+// 根据过期时间放到对应的层和槽
+func (w *TimingWheel) place(e *wheelEntry) {
+	delta := e.expire - w.clk
+	if delta < 0 {
+		w.due.pushBack(e)
+		return
+	}
+	expire := e.expire
+	if delta >= wheelMaxTicks {
+		expire = w.clk + wheelMaxTicks - 1
+		delta = wheelMaxTicks - 1
+	}
+	level := 0
+	for delta >= 1<<(uint(level+1)*wheelBits) {
+		level++
+	}
+	w.slots[level][(expire>>(uint(level)*wheelBits))&wheelMask].pushBack(e)
+	w.pending++
+}
+
+// 从所在的链表中删除
+func (w *TimingWheel) unlink(e *wheelEntry) {
+	if e.list == nil {
+		return
+	}
+	if e.list != &w.due {
+		w.pending--
+	}
+	e.list.remove(e)
+}
@@ -0,0 +1,97 @@
+package gcache
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Prometheus文本格式的指标
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+
+type metric[S any] struct {
+	name  string
+	typ   string
+	help  string
+	value func(s S) int64
+}
+
+var groupMetrics = []metric[Stats]{
+	{"gcache_gets_total", "counter", "Number of keys requested.", func(s Stats) int64 { return s.Gets }},
+	{"gcache_main_cache_hits_total", "counter", "Number of main cache hits.", func(s Stats) int64 { return s.MainCacheHits }},
+	{"gcache_hot_cache_hits_total", "counter", "Number of hot cache hits.", func(s Stats) int64 { return s.HotCacheHits }},
+	{"gcache_loads_total", "counter", "Number of cache misses that required a load.", func(s Stats) int64 { return s.Loads }},
+	{"gcache_loads_deduped_total", "counter", "Number of loads after singleflight deduplication.", func(s Stats) int64 { return s.LoadsDeduped }},
+	{"gcache_peer_loads_total", "counter", "Number of values loaded from peers.", func(s Stats) int64 { return s.PeerLoads }},
+	{"gcache_peer_errors_total", "counter", "Number of failed peer requests.", func(s Stats) int64 { return s.PeerErrors }},
+	{"gcache_local_loads_total", "counter", "Number of values loaded by the getter.", func(s Stats) int64 { return s.LocalLoads }},
+	{"gcache_local_load_errors_total", "counter", "Number of failed getter loads.", func(s Stats) int64 { return s.LocalLoadErrs }},
+}
+
+var cacheMetrics = []metric[CacheStats]{
+	{"gcache_cache_gets_total", "counter", "Number of cache lookups.", func(s CacheStats) int64 { return s.Gets }},
+	{"gcache_cache_hits_total", "counter", "Number of cache hits.", func(s CacheStats) int64 { return s.Hits }},
+	{"gcache_cache_evictions_total", "counter", "Number of evicted or expired entries.", func(s CacheStats) int64 { return s.Evictions }},
+	{"gcache_cache_bytes", "gauge", "Bytes of keys and values in the cache.", func(s CacheStats) int64 { return s.Bytes }},
+	{"gcache_cache_items", "gauge", "Number of entries in the cache.", func(s CacheStats) int64 { return s.Items }},
+}
+
+// MetricsHandler 以Prometheus文本格式输出所有Group的统计信息
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, allGroups())
+		bw.Flush()
+	})
+}
+
+// 按照名称排序的所有Group
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+func writeMetrics(w *bufio.Writer, groups []*Group) {
+	stats := make([]Stats, len(groups))
+	mainStats := make([]CacheStats, len(groups))
+	hotStats := make([]CacheStats, len(groups))
+	for i, g := range groups {
+		stats[i] = g.Stats()
+		mainStats[i] = g.CacheStats(MainCache)
+		hotStats[i] = g.CacheStats(HotCache)
+	}
+	for _, m := range groupMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, g := range groups {
+			fmt.Fprintf(w, "%s{group=\"%s\"} %d\n", m.name, escapeLabel(g.name), m.value(stats[i]))
+		}
+	}
+	for _, m := range cacheMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, g := range groups {
+			name := escapeLabel(g.name)
+			fmt.Fprintf(w, "%s{group=\"%s\",cache=\"main\"} %d\n", m.name, name, m.value(mainStats[i]))
+			if g.hotCache != nil {
+				fmt.Fprintf(w, "%s{group=\"%s\",cache=\"hot\"} %d\n", m.name, name, m.value(hotStats[i]))
+			}
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 转义标签值中的反斜杠、双引号和换行
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
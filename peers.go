@@ -1,11 +1,58 @@
 package gcache
 
-import pb "github.com/jiaxwu/gcache/gcachepb"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jiaxwu/gcache/consistenthash"
+	pb "github.com/jiaxwu/gcache/gcachepb"
+	"github.com/jiaxwu/gcache/registry"
+)
+
+const (
+	// 虚拟节点倍数
+	defaultReplicas = 50
+)
+
+// ErrPeerUnavailable 远程节点暂时不可用（比如已经熔断），请求没有发出
+var ErrPeerUnavailable = errors.New("gcache: peer unavailable")
+
+// 远程节点暂时不可用，retryAfter后可能恢复
+type unavailableError struct {
+	peer       string
+	retryAfter time.Duration
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%s: %v", e.peer, ErrPeerUnavailable)
+}
+
+func (e *unavailableError) Unwrap() error {
+	return ErrPeerUnavailable
+}
+
+// 远程节点不可用的错误预计持续的时间，未知时为默认的熔断时间
+func retryAfter(err error) time.Duration {
+	var e *unavailableError
+	if errors.As(err, &e) && e.retryAfter > 0 {
+		return e.retryAfter
+	}
+	return defaultBreakerCooldown
+}
 
 // PeerGetter 远程客户端，根据group和key获取缓存
+// 带Context后缀的方法会把ctx的截止时间传递给远程节点
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 	Remove(in *pb.Request) error
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+	RemoveContext(ctx context.Context, in *pb.Request) error
+	SetContext(ctx context.Context, in *pb.SetRequest) error
+	GetManyContext(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
 }
 
 // PeerPicker 用于获取远程节点的请求客户端
@@ -13,3 +60,207 @@ type PeerPicker interface {
 	PickPeer(key string) (PeerGetter, bool)
 	GetAll() []PeerGetter
 }
+
+// 伙伴节点集合，使用一致性哈希选择key所在的节点
+// 供不同通信协议的Pool嵌入，节点管理、名字服务和日志相关的方法由各个Pool共用
+type peerSet struct {
+	// 自己的地址
+	self string
+	// 虚拟节点倍数，为0时使用defaultReplicas
+	replicas int
+	// 创建远程节点请求客户端
+	newGetter func(peer string) PeerGetter
+	// 为nil时使用全局日志
+	logger Logger
+	// 保证设置同伴节点安全
+	mu      sync.RWMutex
+	peers   *consistenthash.Map
+	getters map[string]PeerGetter
+}
+
+// 获取日志
+func (s *peerSet) log() Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+	return getLogger()
+}
+
+// Log 以Debug级别输出日志
+func (s *peerSet) Log(format string, v ...any) {
+	s.log().Debug(fmt.Sprintf(format, v...), "server", s.self)
+}
+
+// SetLogger 设置日志，需要在使用之前调用，默认使用全局日志
+func (s *peerSet) SetLogger(l Logger) {
+	s.logger = l
+}
+
+// 创建一致性哈希
+func (s *peerSet) newPeers() *consistenthash.Map {
+	replicas := s.replicas
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return consistenthash.New(replicas, nil)
+}
+
+// Set 更新同伴节点
+func (s *peerSet) Set(peers ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, getter := range s.getters {
+		closeGetter(getter)
+	}
+	s.peers = s.newPeers()
+	s.peers.Add(peers...)
+	s.getters = make(map[string]PeerGetter, len(peers))
+	for _, peer := range peers {
+		s.getters[peer] = s.newGetter(peer)
+	}
+}
+
+// 添加同伴节点
+func (s *peerSet) add(peer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peers == nil {
+		s.peers = s.newPeers()
+		s.getters = make(map[string]PeerGetter)
+	}
+	// 已经存在的节点不重复添加，避免重复的虚拟节点和重建连接
+	if _, ok := s.getters[peer]; ok {
+		return
+	}
+	s.peers.Add(peer)
+	s.getters[peer] = s.newGetter(peer)
+}
+
+// 删除同伴节点
+func (s *peerSet) remove(peer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peers == nil {
+		return
+	}
+	s.peers.Delete(peer)
+	closeGetter(s.getters[peer])
+	delete(s.getters, peer)
+}
+
+// 根据键获取对应的远程节点和客户端，键属于自己时返回false
+func (s *peerSet) pick(key string) (string, PeerGetter, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.peers == nil {
+		return "", nil, false
+	}
+	peer := s.peers.Get(key)
+	if peer == "" || peer == s.self {
+		return "", nil, false
+	}
+	return peer, s.getters[peer], true
+}
+
+// PickPeer 根据键获取对应的远程节点客户端
+func (s *peerSet) PickPeer(key string) (PeerGetter, bool) {
+	peer, getter, ok := s.pick(key)
+	if !ok {
+		return nil, false
+	}
+	s.log().Debug("pick peer", "server", s.self, "peer", peer)
+	return getter, true
+}
+
+// GetAll 获取除自己以外的所有远程节点客户端
+func (s *peerSet) GetAll() []PeerGetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var getters []PeerGetter
+	for name, getter := range s.getters {
+		if name == s.self {
+			continue
+		}
+		getters = append(getters, getter)
+	}
+	return getters
+}
+
+// 获取包括自己在内的所有节点地址
+func (s *peerSet) addrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := []string{s.self}
+	for name := range s.getters {
+		if name != s.self {
+			addrs = append(addrs, name)
+		}
+	}
+	return addrs
+}
+
+// SetETCDRegistry 设置etcd名字服务，使用registry.DefaultPrefix
+func (s *peerSet) SetETCDRegistry(ctx context.Context, etcdAddrs ...string) error {
+	return s.SetETCDRegistryWithPrefix(ctx, registry.DefaultPrefix, etcdAddrs...)
+}
+
+// SetETCDRegistryWithPrefix 设置etcd名字服务并指定key前缀，比如registry.Prefix
+// 集群内所有节点需要使用相同的前缀
+func (s *peerSet) SetETCDRegistryWithPrefix(ctx context.Context, prefix string, etcdAddrs ...string) error {
+	r, err := registry.New(prefix, etcdAddrs)
+	if err != nil {
+		return err
+	}
+	if err := s.SetDiscovery(ctx, r); err != nil {
+		r.Close()
+		return err
+	}
+	// ctx结束后注销自己并关闭连接
+	go func() {
+		<-ctx.Done()
+		r.Close()
+	}()
+	return nil
+}
+
+// SetDiscovery 设置名字服务，注册自己并根据服务变化更新同伴节点，ctx结束后停止
+func (s *peerSet) SetDiscovery(ctx context.Context, r registry.Discovery) error {
+	// 注册自己
+	if err := r.Register(ctx, s.self); err != nil {
+		return err
+	}
+	// 先监听服务变化再拉取所有同伴，拉取期间的变化会在之后重复应用，添加和删除都是幂等的
+	watch := r.Watch(ctx)
+	peers, err := r.GetAddrs(ctx)
+	if err != nil {
+		return err
+	}
+	s.Set(peers...)
+	// 根据服务变化进行更新
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watch:
+				// 通道已经被关闭
+				if !ok {
+					return
+				}
+				if event.AddAddr != "" {
+					s.add(event.AddAddr)
+				} else if event.DeleteAddr != "" {
+					s.remove(event.DeleteAddr)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// 关闭持有连接的远程节点客户端
+func closeGetter(getter PeerGetter) {
+	if closer, ok := getter.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPrefix 名字服务默认的key前缀，拼写错误是历史原因，为了和已部署的节点互相发现而保留
+	DefaultPrefix = "gcahce/"
+	// Prefix 拼写正确的key前缀，集群内所有节点都升级后才能切换，否则新旧节点互相看不到
+	Prefix = "gcache/"
+)
+
+// Discovery 服务注册和发现
+type Discovery interface {
+	// Register 注册自己的地址，ctx结束后注销
+	Register(ctx context.Context, addr string) error
+	// GetAddrs 获取所有节点地址
+	GetAddrs(ctx context.Context) ([]string, error)
+	// Watch 监听节点变化，ctx结束后关闭通道
+	Watch(ctx context.Context) <-chan Event
+}
+
+var (
+	_ Discovery = (*Registry)(nil)
+	_ Discovery = (*Memory)(nil)
+	_ Discovery = (*File)(nil)
+	_ Discovery = (*DNS)(nil)
+	_ Discovery = (*Gossip)(nil)
+)
+
+// 把事件按顺序转发到通道，发送不会阻塞调用方
+type eventQueue struct {
+	mu     sync.Mutex
+	events []Event
+	notify chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{notify: make(chan struct{}, 1)}
+}
+
+// 添加事件
+func (q *eventQueue) push(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.events = append(q.events, events...)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 把事件转发到ch，ctx结束后关闭ch
+func (q *eventQueue) run(ctx context.Context, ch chan<- Event) {
+	defer close(ch)
+	for {
+		q.mu.Lock()
+		events := q.events
+		q.events = nil
+		q.mu.Unlock()
+		for _, event := range events {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 每隔interval获取一次地址列表，和上一次比较后产生事件，获取失败时保留上一次的地址列表
+func pollWatch(ctx context.Context, interval time.Duration, getAddrs func(ctx context.Context) ([]string, error)) <-chan Event {
+	ch := make(chan Event, eventChanSize)
+	q := newEventQueue()
+	last := make(map[string]bool)
+	if addrs, err := getAddrs(ctx); err == nil {
+		for _, addr := range addrs {
+			last[addr] = true
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			addrs, err := getAddrs(ctx)
+			if err != nil {
+				continue
+			}
+			current := make(map[string]bool, len(addrs))
+			var events []Event
+			for _, addr := range addrs {
+				current[addr] = true
+				if !last[addr] {
+					events = append(events, Event{AddAddr: addr})
+				}
+			}
+			for addr := range last {
+				if !current[addr] {
+					events = append(events, Event{DeleteAddr: addr})
+				}
+			}
+			last = current
+			q.push(events...)
+		}
+	}()
+	go q.run(ctx, ch)
+	return ch
+}
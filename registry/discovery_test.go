@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 等待下一个事件
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case event, ok := <-ch:
+		if !ok {
+			t.Fatalf("watch channel closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+	return Event{}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch := m.Watch(ctx)
+
+	regCtx, unregister := context.WithCancel(ctx)
+	if err := m.Register(regCtx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := m.GetAddrs(ctx)
+	if err != nil || !reflect.DeepEqual(addrs, []string{"a", "b"}) {
+		t.Fatalf("addrs=%v err=%v", addrs, err)
+	}
+	if event := nextEvent(t, watch); event.AddAddr != "a" {
+		t.Fatalf("event=%v", event)
+	}
+	if event := nextEvent(t, watch); event.AddAddr != "b" {
+		t.Fatalf("event=%v", event)
+	}
+	unregister()
+	if event := nextEvent(t, watch); event.DeleteAddr != "a" {
+		t.Fatalf("event=%v", event)
+	}
+	cancel()
+	for range watch {
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	if err := os.WriteFile(path, []byte("# peers\na\n\n b \na\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFile(path, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addrs, err := f.GetAddrs(ctx)
+	if err != nil || !reflect.DeepEqual(addrs, []string{"a", "b"}) {
+		t.Fatalf("addrs=%v err=%v", addrs, err)
+	}
+	watch := f.Watch(ctx)
+
+	if err := os.WriteFile(path, []byte("b\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	events := []Event{nextEvent(t, watch), nextEvent(t, watch)}
+	sort.Slice(events, func(i, j int) bool { return events[i].AddAddr < events[j].AddAddr })
+	if !reflect.DeepEqual(events, []Event{{DeleteAddr: "a"}, {AddAddr: "c"}}) {
+		t.Fatalf("events=%v", events)
+	}
+
+	// 文件暂时不存在时保留原来的节点
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.DeleteAddr != "b" {
+		t.Fatalf("event=%v", event)
+	}
+}
+
+// 测试用的DNS解析器
+type stubResolver struct {
+	mu    sync.Mutex
+	srv   []*net.SRV
+	hosts []string
+	err   error
+}
+
+func (r *stubResolver) set(hosts []string, srv []*net.SRV, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts, r.srv, r.err = hosts, srv, err
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service != "http" || proto != "tcp" || name != "gcache.default.svc" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "_http._tcp." + name, r.srv, r.err
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if host != "gcache.default.svc" {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return r.hosts, r.err
+}
+
+func TestDNS(t *testing.T) {
+	resolver := &stubResolver{}
+	resolver.set([]string{"10.0.0.2", "10.0.0.1", "fd00::1"}, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDNS("gcache.default.svc", &DNSOptions{Scheme: "http://", Port: 8080, Resolver: resolver, Interval: 10 * time.Millisecond})
+	addrs, err := d.GetAddrs(ctx)
+	want := []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://[fd00::1]:8080"}
+	if err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("addrs=%v err=%v", addrs, err)
+	}
+	watch := d.Watch(ctx)
+
+	// 解析失败时不产生事件
+	resolver.set(nil, nil, &net.DNSError{Err: "server misbehaving", Name: "gcache.default.svc", IsTemporary: true})
+	time.Sleep(50 * time.Millisecond)
+	resolver.set([]string{"10.0.0.1", "10.0.0.3", "fd00::1"}, nil, nil)
+	events := []Event{nextEvent(t, watch), nextEvent(t, watch)}
+	sort.Slice(events, func(i, j int) bool { return events[i].AddAddr < events[j].AddAddr })
+	if !reflect.DeepEqual(events, []Event{{DeleteAddr: "http://10.0.0.2:8080"}, {AddAddr: "http://10.0.0.3:8080"}}) {
+		t.Fatalf("events=%v", events)
+	}
+
+	// SRV记录
+	resolver.set(nil, []*net.SRV{
+		{Target: "gcache-0.gcache.default.svc.", Port: 8080},
+		{Target: "gcache-1.gcache.default.svc.", Port: 8081},
+	}, nil)
+	d = NewDNS("gcache.default.svc", &DNSOptions{Service: "http", Proto: "tcp", Scheme: "http://", Resolver: resolver})
+	addrs, err = d.GetAddrs(ctx)
+	want = []string{"http://gcache-0.gcache.default.svc:8080", "http://gcache-1.gcache.default.svc:8081"}
+	if err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("addrs=%v err=%v", addrs, err)
+	}
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认重新解析的间隔
+const defaultResolveInterval = 5 * time.Second
+
+// Resolver DNS解析器，*net.Resolver实现了该接口
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSOptions DNS名字服务的配置
+type DNSOptions struct {
+	// SRV记录的服务名和协议，比如"http"和"tcp"，为空时解析A/AAAA记录
+	Service string
+	Proto   string
+	// 节点地址的前缀，比如"http://"
+	Scheme string
+	// 解析A/AAAA记录时节点的端口，为0时地址不带端口
+	Port int
+	// 重新解析的间隔，默认5s
+	Interval time.Duration
+	// DNS解析器，默认net.DefaultResolver
+	Resolver Resolver
+}
+
+// DNS 基于DNS记录的名字服务，比如Kubernetes的headless service
+// 定期解析SRV或者A/AAAA记录，节点地址为Scheme+host:port，需要和节点自己的地址一致
+type DNS struct {
+	name string
+	opts DNSOptions
+}
+
+// NewDNS 创建DNS名字服务，name为要解析的域名
+func NewDNS(name string, opts *DNSOptions) *DNS {
+	d := &DNS{name: name}
+	if opts != nil {
+		d.opts = *opts
+	}
+	if d.opts.Interval <= 0 {
+		d.opts.Interval = defaultResolveInterval
+	}
+	if d.opts.Resolver == nil {
+		d.opts.Resolver = net.DefaultResolver
+	}
+	return d
+}
+
+// Register 节点地址由DNS维护，注册什么都不做
+func (d *DNS) Register(ctx context.Context, addr string) error {
+	return nil
+}
+
+// GetAddrs 解析节点地址列表
+func (d *DNS) GetAddrs(ctx context.Context) ([]string, error) {
+	var hostports []string
+	if d.opts.Service != "" {
+		_, records, err := d.opts.Resolver.LookupSRV(ctx, d.opts.Service, d.opts.Proto, d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			hostports = append(hostports, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+	} else {
+		hosts, err := d.opts.Resolver.LookupHost(ctx, d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			if d.opts.Port != 0 {
+				host = net.JoinHostPort(host, strconv.Itoa(d.opts.Port))
+			} else if strings.Contains(host, ":") {
+				// IPv6地址需要加方括号
+				host = "[" + host + "]"
+			}
+			hostports = append(hostports, host)
+		}
+	}
+	seen := make(map[string]bool, len(hostports))
+	addrs := make([]string, 0, len(hostports))
+	for _, hostport := range hostports {
+		addr := d.opts.Scheme + hostport
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// Watch 发现服务，解析失败时保留上一次的地址列表
+func (d *DNS) Watch(ctx context.Context) <-chan Event {
+	return pollWatch(ctx, d.opts.Interval, d.GetAddrs)
+}
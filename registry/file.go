@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"time"
+)
+
+// 默认检查文件变化的间隔
+const defaultReloadInterval = time.Second
+
+// File 基于静态文件的名字服务，文件每行一个节点地址，忽略空行和#开头的注释
+// 定期检查文件内容，变化时通知监听者
+type File struct {
+	path     string
+	interval time.Duration
+}
+
+// NewFile 创建文件名字服务，interval为检查文件变化的间隔，小于等于0时为1s
+func NewFile(path string, interval time.Duration) *File {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	return &File{path: path, interval: interval}
+}
+
+// Register 节点地址由文件维护，注册什么都不做
+func (f *File) Register(ctx context.Context, addr string) error {
+	return nil
+}
+
+// GetAddrs 获取节点地址列表
+func (f *File) GetAddrs(ctx context.Context) ([]string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		addr := string(bytes.TrimSpace(scanner.Bytes()))
+		if addr == "" || addr[0] == '#' || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs, scanner.Err()
+}
+
+// Watch 发现服务，读取文件失败时保留上一次的地址列表
+func (f *File) Watch(ctx context.Context) <-chan Event {
+	return pollWatch(ctx, f.interval, f.GetAddrs)
+}
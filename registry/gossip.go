@@ -0,0 +1,661 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SWIM: Scalable Weakly-consistent Infection-style Process Group Membership Protocol
+// https://www.cs.cornell.edu/projects/Quicksilver/public_pdfs/SWIM.pdf
+
+const (
+	// 默认探测周期
+	defaultProbeInterval = time.Second
+	// 默认等待探测响应的时间
+	defaultProbeTimeout = 500 * time.Millisecond
+	// 默认间接探测的节点数
+	defaultIndirectChecks = 3
+	// 默认怀疑多少个探测周期后认为节点死亡
+	defaultSuspicionMult = 5
+	// 默认和随机节点交换全部成员的间隔
+	defaultPushPullInterval = 30 * time.Second
+	// 默认广播重发次数的倍数，每条广播重发RetransmitMult*log10(n+1)次
+	defaultRetransmitMult = 4
+	// 每个消息最多捎带的广播数
+	maxPiggyback = 16
+	// 死亡节点保留多少个怀疑超时时间，用于拒绝过时的消息
+	deadReclaimMult = 10
+	// UDP消息最大长度
+	maxPacketSize = 65536
+)
+
+// 消息类型
+type msgType int
+
+const (
+	// 直接探测
+	msgPing msgType = iota
+	// 请求其他节点代为探测Target
+	msgIndirectPing
+	// 探测响应
+	msgAck
+	// 加入时交换全部成员
+	msgSync
+	// 全部成员响应
+	msgSyncAck
+)
+
+// 节点状态
+type memberState int
+
+const (
+	stateAlive memberState = iota
+	stateSuspect
+	stateDead
+)
+
+// 节点之间的消息，Updates为捎带的成员变化
+type message struct {
+	Type    msgType  `json:"t"`
+	Seq     uint64   `json:"s,omitempty"`
+	From    string   `json:"f"`
+	Target  string   `json:"g,omitempty"`
+	Updates []update `json:"u,omitempty"`
+}
+
+// 成员变化，incarnation越大越新，只有节点自己可以增加自己的incarnation
+type update struct {
+	// 节点的gossip地址
+	Name string `json:"n"`
+	// 节点注册的服务地址
+	Addr        string      `json:"a,omitempty"`
+	State       memberState `json:"s"`
+	Incarnation uint64      `json:"i"`
+}
+
+// 已知的成员
+type member struct {
+	update
+	// 怀疑超时或者死亡回收的定时器
+	timer *time.Timer
+}
+
+// 待广播的成员变化
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+// GossipConfig Gossip的配置
+type GossipConfig struct {
+	// UDP监听地址，比如"0.0.0.0:7946"
+	BindAddr string
+	// 其他节点访问自己的地址，默认为监听地址
+	AdvertiseAddr string
+	// 探测周期，默认1s
+	ProbeInterval time.Duration
+	// 等待探测响应的时间，需要小于ProbeInterval，默认500ms
+	ProbeTimeout time.Duration
+	// 直接探测失败后请求多少个节点间接探测，默认3
+	IndirectChecks int
+	// 怀疑多久后认为节点死亡，默认5个探测周期
+	SuspicionTimeout time.Duration
+	// 广播重发次数的倍数，默认4
+	RetransmitMult int
+	// 定期和随机节点交换全部成员，修复广播丢失导致的不一致，默认30s
+	PushPullInterval time.Duration
+}
+
+// Gossip 基于SWIM协议的去中心化名字服务，节点之间通过UDP互相探测并通过捎带的方式传播成员变化
+// 不需要etcd等外部协调服务，节点只需要知道任意一个已有节点即可加入集群
+type Gossip struct {
+	cfg  GossipConfig
+	conn *net.UDPConn
+	// 自己的gossip地址
+	name string
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*member
+	// 每轮打乱顺序依次探测
+	probeList  []string
+	probeIndex int
+	broadcasts []*broadcast
+	seq        uint64
+	// 等待响应的探测
+	acks     map[uint64]chan struct{}
+	watchers map[*eventQueue]struct{}
+	closed   bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewGossip 创建Gossip并开始监听，需要调用Join加入已有集群
+func NewGossip(cfg *GossipConfig) (*Gossip, error) {
+	g := &Gossip{
+		members:  make(map[string]*member),
+		acks:     make(map[uint64]chan struct{}),
+		watchers: make(map[*eventQueue]struct{}),
+		stop:     make(chan struct{}),
+	}
+	if cfg != nil {
+		g.cfg = *cfg
+	}
+	if g.cfg.ProbeInterval <= 0 {
+		g.cfg.ProbeInterval = defaultProbeInterval
+	}
+	if g.cfg.ProbeTimeout <= 0 {
+		g.cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	if g.cfg.ProbeTimeout >= g.cfg.ProbeInterval {
+		return nil, errors.New("probe timeout must be less than probe interval")
+	}
+	if g.cfg.IndirectChecks <= 0 {
+		g.cfg.IndirectChecks = defaultIndirectChecks
+	}
+	if g.cfg.SuspicionTimeout <= 0 {
+		g.cfg.SuspicionTimeout = defaultSuspicionMult * g.cfg.ProbeInterval
+	}
+	if g.cfg.RetransmitMult <= 0 {
+		g.cfg.RetransmitMult = defaultRetransmitMult
+	}
+	if g.cfg.PushPullInterval <= 0 {
+		g.cfg.PushPullInterval = defaultPushPullInterval
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", g.cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	g.conn, err = net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	g.name = g.cfg.AdvertiseAddr
+	if g.name == "" {
+		g.name = g.conn.LocalAddr().String()
+	}
+	g.members[g.name] = &member{update: update{Name: g.name, State: stateAlive}}
+	g.wg.Add(3)
+	go g.readLoop()
+	go g.probeLoop()
+	go g.pushPullLoop()
+	return g, nil
+}
+
+// Name 自己的gossip地址，用于其他节点Join
+func (g *Gossip) Name() string {
+	return g.name
+}
+
+// Join 通过seeds中的任意节点加入集群，和响应的节点交换全部成员
+func (g *Gossip) Join(seeds ...string) error {
+	seq, ch := g.newAck()
+	defer g.deleteAck(seq)
+	g.mu.Lock()
+	self := []update{g.members[g.name].update}
+	g.mu.Unlock()
+	for _, seed := range seeds {
+		if seed != g.name {
+			g.send(seed, &message{Type: msgSync, Seq: seq, Updates: self})
+		}
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(2 * g.cfg.ProbeInterval):
+		return errors.New("gossip: no seed responded")
+	case <-g.stop:
+		return errors.New("gossip: closed")
+	}
+}
+
+// Register 注册自己的服务地址并广播，ctx结束后离开集群并关闭
+func (g *Gossip) Register(ctx context.Context, addr string) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return errors.New("gossip: closed")
+	}
+	g.incarnation++
+	self := g.members[g.name]
+	old := self.update
+	self.update = update{Name: g.name, Addr: addr, State: stateAlive, Incarnation: g.incarnation}
+	g.queueBroadcastLocked(self.update)
+	g.notifyLocked(old, self.update)
+	g.mu.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.Close()
+		case <-g.stop:
+		}
+	}()
+	return nil
+}
+
+// GetAddrs 获取没有死亡的节点的服务地址
+func (g *Gossip) GetAddrs(ctx context.Context) ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var addrs []string
+	for _, m := range g.members {
+		if inRing(m.update) {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// Watch 发现服务
+func (g *Gossip) Watch(ctx context.Context) <-chan Event {
+	q := newEventQueue()
+	g.mu.Lock()
+	g.watchers[q] = struct{}{}
+	g.mu.Unlock()
+	ch := make(chan Event, eventChanSize)
+	go func() {
+		q.run(ctx, ch)
+		g.mu.Lock()
+		delete(g.watchers, q)
+		g.mu.Unlock()
+	}()
+	return ch
+}
+
+// Close 通知其他节点自己离开集群并停止
+func (g *Gossip) Close() error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	leave := update{Name: g.name, Addr: g.members[g.name].Addr, State: stateDead, Incarnation: g.incarnation}
+	var peers []string
+	for name, m := range g.members {
+		if name != g.name && m.State != stateDead {
+			peers = append(peers, name)
+		}
+	}
+	g.mu.Unlock()
+	// 直接通知所有节点，不依赖捎带传播
+	for _, peer := range peers {
+		g.send(peer, &message{Type: msgAck, Updates: []update{leave}})
+	}
+	return g.shutdown()
+}
+
+// 停止所有后台任务并关闭连接
+func (g *Gossip) shutdown() error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	for _, m := range g.members {
+		if m.timer != nil {
+			m.timer.Stop()
+		}
+	}
+	g.mu.Unlock()
+	close(g.stop)
+	err := g.conn.Close()
+	g.wg.Wait()
+	return err
+}
+
+// 接收消息
+func (g *Gossip) readLoop() {
+	defer g.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := g.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-g.stop:
+				return
+			default:
+				continue
+			}
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			continue
+		}
+		g.handle(&msg)
+	}
+}
+
+// 处理消息
+func (g *Gossip) handle(msg *message) {
+	g.mu.Lock()
+	for _, u := range msg.Updates {
+		g.applyLocked(u)
+	}
+	g.mu.Unlock()
+	switch msg.Type {
+	case msgPing:
+		g.send(msg.From, &message{Type: msgAck, Seq: msg.Seq})
+	case msgIndirectPing:
+		go g.relay(msg)
+	case msgAck:
+		g.ack(msg.Seq)
+	case msgSync:
+		g.send(msg.From, &message{Type: msgSyncAck, Seq: msg.Seq, Updates: g.snapshot()})
+	case msgSyncAck:
+		g.ack(msg.Seq)
+	}
+}
+
+// 代替其他节点探测目标节点，成功后把响应转发给请求方
+func (g *Gossip) relay(msg *message) {
+	seq, ch := g.newAck()
+	defer g.deleteAck(seq)
+	g.send(msg.Target, &message{Type: msgPing, Seq: seq})
+	select {
+	case <-ch:
+		g.send(msg.From, &message{Type: msgAck, Seq: msg.Seq})
+	case <-time.After(g.cfg.ProbeTimeout):
+	case <-g.stop:
+	}
+}
+
+// 每个探测周期探测一个节点
+func (g *Gossip) probeLoop() {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if target, ok := g.nextProbe(); ok {
+				g.probe(target)
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// 定期和随机节点交换全部成员
+func (g *Gossip) pushPullLoop() {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.cfg.PushPullInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, peer := range g.randomMembers(1, "") {
+				g.send(peer, &message{Type: msgSync, Updates: g.snapshot()})
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// 选择下一个要探测的节点，每轮打乱一次顺序，保证每个节点在有限时间内被探测
+func (g *Gossip) nextProbe() (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		for g.probeIndex < len(g.probeList) {
+			name := g.probeList[g.probeIndex]
+			g.probeIndex++
+			if m, ok := g.members[name]; ok && m.State != stateDead {
+				return name, true
+			}
+		}
+		g.probeList = g.probeList[:0]
+		for name, m := range g.members {
+			if name != g.name && m.State != stateDead {
+				g.probeList = append(g.probeList, name)
+			}
+		}
+		rand.Shuffle(len(g.probeList), func(i, j int) {
+			g.probeList[i], g.probeList[j] = g.probeList[j], g.probeList[i]
+		})
+		g.probeIndex = 0
+	}
+	return "", false
+}
+
+// 探测节点，直接探测超时后请求其他节点间接探测，都失败时怀疑该节点
+func (g *Gossip) probe(target string) {
+	seq, ch := g.newAck()
+	defer g.deleteAck(seq)
+	g.send(target, &message{Type: msgPing, Seq: seq})
+	select {
+	case <-ch:
+		return
+	case <-time.After(g.cfg.ProbeTimeout):
+	case <-g.stop:
+		return
+	}
+	for _, relay := range g.randomMembers(g.cfg.IndirectChecks, target) {
+		g.send(relay, &message{Type: msgIndirectPing, Seq: seq, Target: target})
+	}
+	select {
+	case <-ch:
+		return
+	case <-time.After(g.cfg.ProbeInterval - g.cfg.ProbeTimeout):
+	case <-g.stop:
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m, ok := g.members[target]; ok && m.State == stateAlive {
+		g.applyLocked(update{Name: target, Addr: m.Addr, State: stateSuspect, Incarnation: m.Incarnation})
+	}
+}
+
+// 随机选择最多k个除自己和exclude以外的存活节点
+func (g *Gossip) randomMembers(k int, exclude string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var names []string
+	for name, m := range g.members {
+		if name != g.name && name != exclude && m.State == stateAlive {
+			names = append(names, name)
+		}
+	}
+	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	if len(names) > k {
+		names = names[:k]
+	}
+	return names
+}
+
+// 应用成员变化，需要持有锁
+func (g *Gossip) applyLocked(u update) {
+	if g.closed {
+		return
+	}
+	if u.Name == g.name {
+		g.applySelfLocked(u)
+		return
+	}
+	m, ok := g.members[u.Name]
+	if !ok {
+		// 只从存活消息认识新节点
+		if u.State != stateAlive {
+			return
+		}
+		m = &member{}
+		g.members[u.Name] = m
+	} else if !supersedes(u, m.update) {
+		return
+	}
+	old := m.update
+	m.update = u
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	switch u.State {
+	case stateSuspect:
+		m.timer = time.AfterFunc(g.cfg.SuspicionTimeout, func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if cur, ok := g.members[u.Name]; ok && cur.State == stateSuspect && cur.Incarnation == u.Incarnation {
+				g.applyLocked(update{Name: u.Name, Addr: u.Addr, State: stateDead, Incarnation: u.Incarnation})
+			}
+		})
+	case stateDead:
+		m.timer = time.AfterFunc(deadReclaimMult*g.cfg.SuspicionTimeout, func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if cur, ok := g.members[u.Name]; ok && cur.State == stateDead && cur.Incarnation == u.Incarnation {
+				delete(g.members, u.Name)
+			}
+		})
+	}
+	g.queueBroadcastLocked(u)
+	g.notifyLocked(old, u)
+}
+
+// 应用关于自己的变化，其他节点怀疑自己、认为自己死亡或者持有重启前的信息时，增加incarnation反驳
+func (g *Gossip) applySelfLocked(u update) {
+	self := g.members[g.name]
+	if u.Incarnation < g.incarnation || u == self.update {
+		return
+	}
+	g.incarnation = u.Incarnation + 1
+	self.Incarnation = g.incarnation
+	g.queueBroadcastLocked(self.update)
+}
+
+// u是否比cur新
+func supersedes(u, cur update) bool {
+	switch u.State {
+	case stateAlive:
+		return u.Incarnation > cur.Incarnation
+	case stateSuspect:
+		return cur.State == stateAlive && u.Incarnation >= cur.Incarnation ||
+			cur.State == stateSuspect && u.Incarnation > cur.Incarnation
+	default:
+		return cur.State != stateDead && u.Incarnation >= cur.Incarnation
+	}
+}
+
+// 节点是否在哈希环中，被怀疑的节点仍然在
+func inRing(u update) bool {
+	return u.State != stateDead && u.Addr != ""
+}
+
+// 通知监听者服务地址的变化，需要持有锁
+func (g *Gossip) notifyLocked(old, cur update) {
+	var events []Event
+	if inRing(old) && (!inRing(cur) || old.Addr != cur.Addr) {
+		events = append(events, Event{DeleteAddr: old.Addr})
+	}
+	if inRing(cur) && (!inRing(old) || old.Addr != cur.Addr) {
+		events = append(events, Event{AddAddr: cur.Addr})
+	}
+	for q := range g.watchers {
+		q.push(events...)
+	}
+}
+
+// 加入广播队列，同一个节点只保留最新的变化，需要持有锁
+func (g *Gossip) queueBroadcastLocked(u update) {
+	for i, b := range g.broadcasts {
+		if b.update.Name == u.Name {
+			g.broadcasts = append(g.broadcasts[:i], g.broadcasts[i+1:]...)
+			break
+		}
+	}
+	g.broadcasts = append(g.broadcasts, &broadcast{update: u})
+}
+
+// 取出要捎带的广播，优先发送次数少的，需要持有锁
+func (g *Gossip) piggybackLocked() []update {
+	if len(g.broadcasts) == 0 {
+		return nil
+	}
+	limit := g.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(g.members)+1))))
+	sort.SliceStable(g.broadcasts, func(i, j int) bool {
+		return g.broadcasts[i].transmits < g.broadcasts[j].transmits
+	})
+	var updates []update
+	for _, b := range g.broadcasts {
+		if len(updates) == maxPiggyback {
+			break
+		}
+		updates = append(updates, b.update)
+		b.transmits++
+	}
+	remaining := g.broadcasts[:0]
+	for _, b := range g.broadcasts {
+		if b.transmits < limit {
+			remaining = append(remaining, b)
+		}
+	}
+	g.broadcasts = remaining
+	return updates
+}
+
+// 所有已知成员
+func (g *Gossip) snapshot() []update {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	updates := make([]update, 0, len(g.members))
+	for _, m := range g.members {
+		updates = append(updates, m.update)
+	}
+	return updates
+}
+
+// 发送消息并捎带广播
+func (g *Gossip) send(to string, msg *message) {
+	addr, err := net.ResolveUDPAddr("udp", to)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	msg.From = g.name
+	msg.Updates = append(msg.Updates, g.piggybackLocked()...)
+	g.mu.Unlock()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	g.conn.WriteToUDP(data, addr)
+}
+
+// 创建等待响应的探测
+func (g *Gossip) newAck() (uint64, chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq++
+	ch := make(chan struct{}, 1)
+	g.acks[g.seq] = ch
+	return g.seq, ch
+}
+
+func (g *Gossip) deleteAck(seq uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.acks, seq)
+}
+
+// 收到响应
+func (g *Gossip) ack(seq uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ch, ok := g.acks[seq]; ok {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 启动n个loopback上的节点并通过第一个节点加入集群
+func newGossipCluster(t *testing.T, ctx context.Context, n int) []*Gossip {
+	t.Helper()
+	nodes := make([]*Gossip, n)
+	for i := range nodes {
+		g, err := NewGossip(&GossipConfig{
+			BindAddr:         "127.0.0.1:0",
+			ProbeInterval:    50 * time.Millisecond,
+			ProbeTimeout:     20 * time.Millisecond,
+			SuspicionTimeout: 300 * time.Millisecond,
+			PushPullInterval: 200 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { g.Close() })
+		if err := g.Register(ctx, fmt.Sprintf("http://node-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			if err := g.Join(nodes[0].Name()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nodes[i] = g
+	}
+	return nodes
+}
+
+// 等待所有节点看到的服务地址都为want
+func waitAddrs(t *testing.T, nodes []*Gossip, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, g := range nodes {
+		for {
+			addrs, _ := g.GetAddrs(context.Background())
+			if reflect.DeepEqual(addrs, want) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node %s addrs=%v, want %v", g.Name(), addrs, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// 等待删除addr的事件，负载高时可能有节点被误判死亡后又反驳
+func waitDelete(t *testing.T, watch <-chan Event, addr string) {
+	t.Helper()
+	for nextEvent(t, watch).DeleteAddr != addr {
+	}
+}
+
+func addrsOf(n int, exclude ...int) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		excluded := false
+		for _, j := range exclude {
+			excluded = excluded || i == j
+		}
+		if !excluded {
+			addrs = append(addrs, fmt.Sprintf("http://node-%d", i))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+func TestGossip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const n = 16
+	nodes := newGossipCluster(t, ctx, n)
+	waitAddrs(t, nodes, addrsOf(n))
+
+	watch := nodes[0].Watch(ctx)
+	// 节点崩溃，通过探测和怀疑超时发现
+	if err := nodes[3].shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	alive := append(append([]*Gossip{}, nodes[:3]...), nodes[4:]...)
+	waitAddrs(t, alive, addrsOf(n, 3))
+	waitDelete(t, watch, "http://node-3")
+
+	// 节点主动离开，马上通知其他节点
+	if err := nodes[5].Close(); err != nil {
+		t.Fatal(err)
+	}
+	alive = append(append([]*Gossip{}, nodes[:3]...), nodes[4], nodes[6], nodes[7])
+	waitAddrs(t, alive, addrsOf(n, 3, 5))
+	waitDelete(t, watch, "http://node-5")
+}
+
+func TestGossip_Refute(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := newGossipCluster(t, ctx, 3)
+	waitAddrs(t, nodes, addrsOf(3))
+
+	// 错误地怀疑一个存活的节点，该节点增加incarnation反驳
+	target := nodes[1]
+	target.mu.Lock()
+	incarnation := target.incarnation
+	target.mu.Unlock()
+	nodes[0].mu.Lock()
+	nodes[0].applyLocked(update{Name: target.Name(), Addr: "http://node-1", State: stateSuspect, Incarnation: incarnation})
+	nodes[0].mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		nodes[0].mu.Lock()
+		m := nodes[0].members[target.Name()].update
+		nodes[0].mu.Unlock()
+		if m.State == stateAlive && m.Incarnation > incarnation {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("suspicion not refuted, member=%+v", m)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitAddrs(t, nodes, addrsOf(3))
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory 内存中的名字服务，用于测试和单进程多节点
+type Memory struct {
+	mu sync.Mutex
+	// 地址到注册次数
+	addrs    map[string]int
+	watchers map[*eventQueue]struct{}
+}
+
+// NewMemory 创建内存名字服务
+func NewMemory() *Memory {
+	return &Memory{
+		addrs:    make(map[string]int),
+		watchers: make(map[*eventQueue]struct{}),
+	}
+}
+
+// Register 注册服务，ctx结束后注销
+func (m *Memory) Register(ctx context.Context, addr string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.addrs[addr]++
+	if m.addrs[addr] == 1 {
+		m.broadcast(Event{AddAddr: addr})
+	}
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.addrs[addr]--
+		if m.addrs[addr] == 0 {
+			delete(m.addrs, addr)
+			m.broadcast(Event{DeleteAddr: addr})
+		}
+	}()
+	return nil
+}
+
+// GetAddrs 获取节点地址列表
+func (m *Memory) GetAddrs(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	addrs := make([]string, 0, len(m.addrs))
+	for addr := range m.addrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// Watch 发现服务
+func (m *Memory) Watch(ctx context.Context) <-chan Event {
+	q := newEventQueue()
+	m.mu.Lock()
+	m.watchers[q] = struct{}{}
+	m.mu.Unlock()
+	ch := make(chan Event, eventChanSize)
+	go func() {
+		q.run(ctx, ch)
+		m.mu.Lock()
+		delete(m.watchers, q)
+		m.mu.Unlock()
+	}()
+	return ch
+}
+
+// 通知所有监听者，需要持有锁
+func (m *Memory) broadcast(event Event) {
+	for q := range m.watchers {
+		q.push(event)
+	}
+}
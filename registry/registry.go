@@ -2,11 +2,12 @@ package registry
 
 import (
 	"context"
-	"fmt"
-	"go.etcd.io/etcd/api/v3/mvccpb"
-	etcd "go.etcd.io/etcd/client/v3"
+	"errors"
 	"sync"
 	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcd "go.etcd.io/etcd/client/v3"
 )
 
 const (
@@ -14,6 +15,12 @@ const (
 	keepAliveTTL = 10
 	// 事件通道缓冲区大小
 	eventChanSize = 10
+	// 重新注册和重新监听的最小间隔
+	minRetryInterval = 100 * time.Millisecond
+	// 重新注册和重新监听的最大间隔
+	maxRetryInterval = 5 * time.Second
+	// 注销的超时时间
+	revokeTimeout = 3 * time.Second
 )
 
 // Event 服务变化事件
@@ -26,10 +33,23 @@ type Event struct {
 type Registry struct {
 	// etcd服务器地址
 	endpoints []string
-	mu        sync.Mutex
 	client    *etcd.Client
 	// etcd名字服务key前缀
 	prefix string
+	// 租约时间，单位秒
+	ttl int64
+
+	mu sync.Mutex
+	// 注册的服务地址
+	registrations map[string]*registration
+	closed        bool
+}
+
+// 一次注册，租约丢失后自动重新注册
+type registration struct {
+	cancel context.CancelFunc
+	// 注销完成后关闭
+	done chan struct{}
 }
 
 func New(prefix string, endpoints []string) (*Registry, error) {
@@ -41,66 +61,235 @@ func New(prefix string, endpoints []string) (*Registry, error) {
 		return nil, err
 	}
 	return &Registry{
-		endpoints: endpoints,
-		client:    client,
-		prefix:    prefix,
+		endpoints:     endpoints,
+		client:        client,
+		prefix:        prefix,
+		ttl:           keepAliveTTL,
+		registrations: make(map[string]*registration),
 	}, nil
 }
 
-// Register 注册服务
+// Register 注册服务，租约丢失后自动重新注册，ctx结束后注销
 func (r *Registry) Register(ctx context.Context, addr string) error {
-	kv := etcd.NewKV(r.client)
-	lease := etcd.NewLease(r.client)
-	grant, err := lease.Grant(ctx, keepAliveTTL)
+	regCtx, cancel := context.WithCancel(ctx)
+	leaseID, ch, err := r.register(regCtx, addr)
 	if err != nil {
+		cancel()
 		return err
 	}
-	key := fmt.Sprintf("%s%s", r.prefix, addr)
-	if _, err := kv.Put(ctx, key, addr, etcd.WithLease(grant.ID)); err != nil {
-		return err
+	reg := &registration{cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		cancel()
+		r.revoke(leaseID)
+		return errors.New("registry closed")
+	}
+	old := r.registrations[addr]
+	r.registrations[addr] = reg
+	r.mu.Unlock()
+	if old != nil {
+		old.cancel()
+		<-old.done
 	}
-	ch, err := lease.KeepAlive(ctx, grant.ID)
+	go r.keepAlive(regCtx, reg, addr, leaseID, ch)
+	return nil
+}
+
+// 创建租约并写入地址
+func (r *Registry) register(ctx context.Context, addr string) (etcd.LeaseID, <-chan *etcd.LeaseKeepAliveResponse, error) {
+	grant, err := r.client.Grant(ctx, r.ttl)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	go func() {
-		for range ch {
+	if _, err := r.client.Put(ctx, r.prefix+addr, addr, etcd.WithLease(grant.ID)); err != nil {
+		r.revoke(grant.ID)
+		return 0, nil, err
+	}
+	ch, err := r.client.KeepAlive(ctx, grant.ID)
+	if err != nil {
+		r.revoke(grant.ID)
+		return 0, nil, err
+	}
+	return grant.ID, ch, nil
+}
+
+// 续约，续约通道关闭说明租约丢失，比如长时间连不上etcd导致过期，此时重新注册
+// ctx结束后撤销租约，使其他节点马上删除自己
+func (r *Registry) keepAlive(ctx context.Context, reg *registration, addr string, leaseID etcd.LeaseID, ch <-chan *etcd.LeaseKeepAliveResponse) {
+	defer func() {
+		r.mu.Lock()
+		if r.registrations[addr] == reg {
+			delete(r.registrations, addr)
 		}
+		r.mu.Unlock()
+		close(reg.done)
 	}()
-	return nil
+	for {
+		for range ch {
+		}
+		if ctx.Err() != nil {
+			r.revoke(leaseID)
+			return
+		}
+		var err error
+		for interval := minRetryInterval; ; interval = nextRetryInterval(interval) {
+			if leaseID, ch, err = r.register(ctx, addr); err == nil {
+				break
+			}
+			if !sleep(ctx, interval) {
+				return
+			}
+		}
+	}
+}
+
+// 撤销租约，租约关联的key会被删除
+func (r *Registry) revoke(leaseID etcd.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	r.client.Revoke(ctx, leaseID)
+}
+
+// Close 注销所有服务并关闭etcd客户端
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	registrations := r.registrations
+	r.registrations = nil
+	r.mu.Unlock()
+	for _, reg := range registrations {
+		reg.cancel()
+		<-reg.done
+	}
+	return r.client.Close()
 }
 
 // GetAddrs 获取节点地址列表
 func (r *Registry) GetAddrs(ctx context.Context) ([]string, error) {
-	kv := etcd.NewKV(r.client)
-	resp, err := kv.Get(ctx, r.prefix, etcd.WithPrefix())
+	addrs, _, err := r.getAddrs(ctx)
+	return addrs, err
+}
+
+// 获取节点地址列表和对应的版本
+func (r *Registry) getAddrs(ctx context.Context) ([]string, int64, error) {
+	resp, err := r.client.Get(ctx, r.prefix, etcd.WithPrefix())
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	addrs := make([]string, len(resp.Kvs))
 	for i, kv := range resp.Kvs {
-		addrs[i] = string(kv.Value)
+		addrs[i] = string(kv.Key[len(r.prefix):])
 	}
-	return addrs, nil
+	return addrs, resp.Header.Revision, nil
 }
 
-// Watch 发现服务
+// Watch 发现服务，从返回前获取的版本之后开始监听，获取失败时稍后同步全部节点并发送添加事件
+// 监听被中断（比如历史版本被压缩、leader切换）后重新同步全部节点
 func (r *Registry) Watch(ctx context.Context) <-chan Event {
-	watcher := etcd.NewWatcher(r.client)
-	watchChan := watcher.Watch(ctx, r.prefix, etcd.WithPrefix())
+	addrs, rev, err := r.getAddrs(ctx)
+	if err != nil {
+		return r.watch(ctx, 0, make(map[string]bool))
+	}
+	known := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		known[addr] = true
+	}
+	return r.watch(ctx, rev, known)
+}
+
+// 从rev之后开始监听，known为rev时的节点，rev为0时先同步全部节点
+func (r *Registry) watch(ctx context.Context, rev int64, known map[string]bool) <-chan Event {
 	ch := make(chan Event, eventChanSize)
+	q := newEventQueue()
 	go func() {
-		for watchRsp := range watchChan {
-			for _, event := range watchRsp.Events {
-				switch event.Type {
-				case mvccpb.PUT:
-					ch <- Event{AddAddr: string(event.Kv.Value)}
-				case mvccpb.DELETE:
-					ch <- Event{DeleteAddr: string(event.Kv.Key[len(r.prefix):])}
+		interval := minRetryInterval
+		for {
+			if rev == 0 {
+				addrs, cur, err := r.getAddrs(ctx)
+				if err != nil {
+					if !sleep(ctx, interval) {
+						return
+					}
+					interval = nextRetryInterval(interval)
+					continue
 				}
+				known = r.resync(q, known, addrs)
+				rev = cur
 			}
+			// 每次监听使用单独的ctx，中断后马上释放旧的监听
+			watchCtx, cancel := context.WithCancel(etcd.WithRequireLeader(ctx))
+			wch := r.client.Watch(watchCtx, r.prefix, etcd.WithPrefix(), etcd.WithRev(rev+1))
+			for resp := range wch {
+				if resp.Err() != nil {
+					break
+				}
+				interval = minRetryInterval
+				for _, event := range resp.Events {
+					addr := string(event.Kv.Key[len(r.prefix):])
+					switch event.Type {
+					case mvccpb.PUT:
+						if !known[addr] {
+							known[addr] = true
+							q.push(Event{AddAddr: addr})
+						}
+					case mvccpb.DELETE:
+						if known[addr] {
+							delete(known, addr)
+							q.push(Event{DeleteAddr: addr})
+						}
+					}
+				}
+				rev = resp.Header.Revision
+			}
+			cancel()
+			// 监听中断期间可能丢失事件，重新同步
+			rev = 0
+			if !sleep(ctx, interval) {
+				return
+			}
+			interval = nextRetryInterval(interval)
 		}
-		close(ch)
 	}()
+	go q.run(ctx, ch)
 	return ch
 }
+
+// 根据全部节点产生和known的差异事件
+func (r *Registry) resync(q *eventQueue, known map[string]bool, addrs []string) map[string]bool {
+	current := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		current[addr] = true
+		if !known[addr] {
+			q.push(Event{AddAddr: addr})
+		}
+	}
+	for addr := range known {
+		if !current[addr] {
+			q.push(Event{DeleteAddr: addr})
+		}
+	}
+	return current
+}
+
+// 等待d，ctx结束时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// 指数退避
+func nextRetryInterval(interval time.Duration) time.Duration {
+	if interval *= 2; interval > maxRetryInterval {
+		interval = maxRetryInterval
+	}
+	return interval
+}
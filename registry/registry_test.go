@@ -0,0 +1,164 @@
+//go:build etcd
+
+// 需要一个可以访问的etcd，通过GCACHE_ETCD_ENDPOINT指定地址：
+// GCACHE_ETCD_ENDPOINT=127.0.0.1:2379 go test -tags etcd ./registry
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// 获取etcd地址，默认使用本地etcd
+func etcdEndpoint() string {
+	if endpoint := os.Getenv("GCACHE_ETCD_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return "127.0.0.1:2379"
+}
+
+// 每个测试使用单独的前缀，互不影响
+func testPrefix(t *testing.T) string {
+	return fmt.Sprintf("gcache-test/%s/%d/", t.Name(), time.Now().UnixNano())
+}
+
+func newTestRegistry(t *testing.T, prefix string) *Registry {
+	r, err := New(prefix, []string{etcdEndpoint()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ttl = 2
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// 等待地址列表为want
+func waitRegistryAddrs(t *testing.T, r *Registry, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		addrs, err := r.GetAddrs(context.Background())
+		sort.Strings(addrs)
+		if err == nil && (len(addrs) == 0 && len(want) == 0 || reflect.DeepEqual(addrs, want)) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("addrs=%v err=%v, want %v", addrs, err, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	prefix := testPrefix(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := newTestRegistry(t, prefix), newTestRegistry(t, prefix)
+	if err := a.Register(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	watch := a.Watch(ctx)
+	if err := b.Register(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.AddAddr != "b" {
+		t.Fatalf("event=%v", event)
+	}
+	// 重复注册不产生事件
+	if err := b.Register(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	waitRegistryAddrs(t, a, "a", "b")
+
+	// 租约丢失后重新注册
+	resp, err := a.client.Get(ctx, prefix+"b")
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("get b failed, resp=%v err=%v", resp, err)
+	}
+	lease := etcd.LeaseID(resp.Kvs[0].Lease)
+	if _, err := a.client.Revoke(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.DeleteAddr != "b" {
+		t.Fatalf("event=%v", event)
+	}
+	select {
+	case event := <-watch:
+		if event.AddAddr != "b" {
+			t.Fatalf("event=%v", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("b not re-registered after lease lost")
+	}
+
+	// 关闭时撤销租约，其他节点马上删除
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.DeleteAddr != "b" {
+		t.Fatalf("event=%v", event)
+	}
+	waitRegistryAddrs(t, a, "a")
+
+	// ctx结束后注销
+	regCtx, unregister := context.WithCancel(ctx)
+	if err := a.Register(regCtx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.AddAddr != "c" {
+		t.Fatalf("event=%v", event)
+	}
+	unregister()
+	if event := nextEvent(t, watch); event.DeleteAddr != "c" {
+		t.Fatalf("event=%v", event)
+	}
+}
+
+func TestRegistry_WatchCompacted(t *testing.T) {
+	prefix := testPrefix(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := newTestRegistry(t, prefix)
+	resp, err := r.client.Put(ctx, prefix+"a", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := resp.Header.Revision
+	if _, err := r.client.Put(ctx, prefix+"b", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.client.Delete(ctx, prefix+"a"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = r.client.Put(ctx, prefix+"c", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.client.Compact(ctx, resp.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+
+	// 从被压缩的版本开始监听，重新同步全部节点
+	watch := r.watch(ctx, rev, map[string]bool{"a": true})
+	events := []Event{nextEvent(t, watch), nextEvent(t, watch), nextEvent(t, watch)}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].AddAddr+events[i].DeleteAddr < events[j].AddAddr+events[j].DeleteAddr
+	})
+	if !reflect.DeepEqual(events, []Event{{DeleteAddr: "a"}, {AddAddr: "b"}, {AddAddr: "c"}}) {
+		t.Fatalf("events=%v", events)
+	}
+	// 同步后继续监听
+	if _, err := r.client.Put(ctx, prefix+"d", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, watch); event.AddAddr != "d" {
+		t.Fatalf("event=%v", event)
+	}
+}
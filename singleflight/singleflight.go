@@ -0,0 +1,208 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrMissing 批量执行的结果中缺少该key
+var ErrMissing = errors.New("singleflight: missing from batch result")
+
+// 正在执行或者已经完成的调用
+type call[V any] struct {
+	// 完成后关闭
+	done chan struct{}
+	val  V
+	err  error
+	// 等待结果的调用方数量，需要持有Group.mu
+	waiters int
+	// 所有调用方都放弃等待时调用，需要持有Group.mu，只有DoContext和DoMany发起的调用不为nil
+	abandon func()
+}
+
+func newCall[V any]() *call[V] {
+	return &call[V]{done: make(chan struct{}), waiters: 1}
+}
+
+// Group 保证同一时间相同key只会执行一次，其他调用方等待并共享结果
+type Group[V any] struct {
+	mu sync.Mutex
+	m  map[string]*call[V]
+}
+
+// Do 执行fn，返回值shared表示结果是否与其他调用方共享
+func (g *Group[V]) Do(key string, fn func() (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err, true
+	}
+	c := newCall[V]()
+	g.m[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	g.done(key, c)
+	return c.val, c.err, false
+}
+
+// DoContext 在新的协程中执行fn，每个调用方只等待到自己的ctx结束
+// fn的ctx保留第一个调用方ctx中的值，但不会随其取消，所有调用方都放弃等待后才取消
+func (g *Group[V]) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call[V])
+	}
+	c, shared := g.m[key]
+	if shared {
+		c.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(withoutCancel{ctx})
+		c = newCall[V]()
+		c.abandon = cancel
+		g.m[key] = c
+		go func() {
+			defer cancel()
+			c.val, c.err = fn(callCtx)
+			g.done(key, c)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.leave(key, c)
+		return v, ctx.Err(), shared
+	}
+}
+
+// 调用方放弃等待，最后一个调用方放弃时取消执行
+func (g *Group[V]) leave(key string, c *call[V]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 || c.abandon == nil {
+		return
+	}
+	c.abandon()
+	// 之后的调用方重新执行，不再等待已经取消的调用
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
+
+// 保留父ctx中的值但不会随其取消，go1.21之后可以使用context.WithoutCancel
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (withoutCancel) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancel) Err() error {
+	return nil
+}
+
+// DoMany 批量执行fn
+// 已经在执行的key等待其结果，其余key交给一次fn调用在新的协程中执行
+// 与DoContext一样，fn的ctx不随调用方取消，每个调用方只等待到自己的ctx结束，
+// 这些key的所有调用方都放弃等待后才取消fn，放弃等待的key错误为ctx.Err()
+// fn返回结果中既没有值也没有错误的key，错误为ErrMissing
+func (g *Group[V]) DoMany(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) (map[string]V, map[string]error)) (map[string]V, map[string]error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call[V])
+	}
+	// 先占据所有没有在执行的key，再执行fn，这样批量调用之间不会互相等待造成死锁
+	calls := make(map[string]*call[V], len(keys))
+	owned := make(map[string]*call[V])
+	var ownedKeys []string
+	for _, key := range keys {
+		// 重复的key只计算一次
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		if c, ok := g.m[key]; ok {
+			c.waiters++
+			calls[key] = c
+			continue
+		}
+		c := newCall[V]()
+		g.m[key] = c
+		calls[key] = c
+		owned[key] = c
+		ownedKeys = append(ownedKeys, key)
+	}
+	if len(ownedKeys) > 0 {
+		callCtx, cancel := context.WithCancel(withoutCancel{ctx})
+		// 所有key都被放弃后才取消fn
+		pending := len(ownedKeys)
+		for _, c := range owned {
+			c.abandon = func() {
+				if pending--; pending == 0 {
+					cancel()
+				}
+			}
+		}
+		go func() {
+			defer cancel()
+			fnVals, fnErrs := fn(callCtx, ownedKeys)
+			for key, c := range owned {
+				if v, ok := fnVals[key]; ok {
+					c.val = v
+				} else if err, ok := fnErrs[key]; ok && err != nil {
+					c.err = err
+				} else {
+					c.err = ErrMissing
+				}
+				g.done(key, c)
+			}
+		}()
+	}
+	g.mu.Unlock()
+
+	vals := make(map[string]V, len(calls))
+	errs := make(map[string]error)
+	for key, c := range calls {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+		select {
+		case <-c.done:
+			if c.err != nil {
+				errs[key] = c.err
+			} else {
+				vals[key] = c.val
+			}
+		default:
+			g.leave(key, c)
+			errs[key] = ctx.Err()
+		}
+	}
+	return vals, errs
+}
+
+// 完成调用，唤醒等待的调用方
+func (g *Group[V]) done(key string, c *call[V]) {
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
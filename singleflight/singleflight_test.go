@@ -0,0 +1,233 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group[string]
+	v, err, _ := g.Do("key", func() (string, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do = %v, %v", v, err)
+	}
+}
+
+func TestDoErr(t *testing.T) {
+	var g Group[string]
+	someErr := errors.New("some error")
+	v, err, _ := g.Do("key", func() (string, error) {
+		return "", someErr
+	})
+	if err != someErr || v != "" {
+		t.Errorf("Do = %v, %v; want someErr", v, err)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group[string]
+	c := make(chan string)
+	var calls int32
+	fn := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return <-c, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			v, err, _ := g.Do("key", fn)
+			if err != nil || v != "bar" {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			wg.Done()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	c <- "bar"
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+}
+
+func TestDoMany(t *testing.T) {
+	var g Group[string]
+	someErr := errors.New("some error")
+	vals, errs := g.DoMany(context.Background(), []string{"a", "b", "c", "a"}, func(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+		if len(keys) != 3 {
+			t.Errorf("batch keys = %v; want 3 distinct keys", keys)
+		}
+		return map[string]string{"a": "A"}, map[string]error{"b": someErr}
+	})
+	if len(vals) != 1 || vals["a"] != "A" {
+		t.Errorf("DoMany values = %v", vals)
+	}
+	if errs["b"] != someErr || errs["c"] != ErrMissing {
+		t.Errorf("DoMany errors = %v", errs)
+	}
+}
+
+func TestDoManyShare(t *testing.T) {
+	var g Group[string]
+	c := make(chan string)
+	started := make(chan struct{})
+	go g.Do("a", func() (string, error) {
+		close(started)
+		return <-c, nil
+	})
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		vals, errs := g.DoMany(context.Background(), []string{"a", "b"}, func(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+			if len(keys) != 1 || keys[0] != "b" {
+				t.Errorf("batch keys = %v; want [b]", keys)
+			}
+			return map[string]string{"b": "B"}, nil
+		})
+		if vals["a"] != "A" || vals["b"] != "B" || len(errs) != 0 {
+			t.Errorf("DoMany = %v, %v", vals, errs)
+		}
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	c <- "A"
+	<-done
+}
+
+func TestDoManyContext(t *testing.T) {
+	var g Group[string]
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+	fn := func(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+		select {
+		case <-release:
+			return map[string]string{"a": "A", "b": "B"}, nil
+		case <-ctx.Done():
+			fnErr <- ctx.Err()
+			return nil, nil
+		}
+	}
+
+	// 批量调用方放弃后，等待同一个key的其他调用方仍然可以得到结果
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan map[string]error, 1)
+	go func() {
+		_, errs := g.DoMany(ctx, []string{"a", "b", "a"}, fn)
+		first <- errs
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string, 1)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "a", func(ctx context.Context) (string, error) {
+			t.Errorf("key a executed twice")
+			return "", nil
+		})
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if errs := <-first; errs["a"] != context.Canceled || errs["b"] != context.Canceled {
+		t.Fatalf("first caller errs = %v", errs)
+	}
+	close(release)
+	if v := <-second; v != "A" {
+		t.Fatalf("second caller = %v", v)
+	}
+	select {
+	case err := <-fnErr:
+		t.Fatalf("fn cancelled while callers waiting: %v", err)
+	default:
+	}
+
+	// 所有调用方都放弃后取消执行
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release = make(chan struct{})
+	if _, errs := g.DoMany(ctx, []string{"a", "a"}, fn); errs["a"] != context.DeadlineExceeded {
+		t.Fatalf("caller errs = %v", errs)
+	}
+	select {
+	case <-fnErr:
+	case <-time.After(time.Second):
+		t.Fatalf("fn not cancelled after all callers gave up")
+	}
+	close(release)
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group[string]
+	type ctxKey struct{}
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+	fn := func(ctx context.Context) (string, error) {
+		if ctx.Value(ctxKey{}) != "value" {
+			t.Errorf("ctx value not kept")
+		}
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			fnErr <- ctx.Err()
+			return "", ctx.Err()
+		}
+	}
+
+	// 第一个调用方放弃后，其他调用方仍然可以得到结果
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	first := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctx, "key", fn)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string, 1)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "key", fn)
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("first caller err = %v", err)
+	}
+	close(release)
+	if v := <-second; v != "bar" {
+		t.Fatalf("second caller = %v", v)
+	}
+	select {
+	case err := <-fnErr:
+		t.Fatalf("fn cancelled while callers waiting: %v", err)
+	default:
+	}
+
+	// 所有调用方都放弃后取消执行，之后的调用重新执行
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	release = make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err, _ := g.DoContext(ctx, "key", fn); err != context.Canceled {
+		t.Fatalf("caller err = %v", err)
+	}
+	select {
+	case <-fnErr:
+	case <-time.After(time.Second):
+		t.Fatalf("fn not cancelled after all callers gave up")
+	}
+	close(release)
+	ctx = context.WithValue(context.Background(), ctxKey{}, "value")
+	if v, err, shared := g.DoContext(ctx, "key", fn); v != "bar" || err != nil || shared {
+		t.Fatalf("DoContext = %v, %v, shared=%v", v, err, shared)
+	}
+}
@@ -0,0 +1,115 @@
+package gcache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// AtomicInt 并发安全的计数器
+type AtomicInt int64
+
+// Add 原子增加n
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get 原子读取
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// 统计Group的请求情况
+type groupStats struct {
+	// 请求的key数量
+	gets AtomicInt
+	// mainCache命中次数
+	mainCacheHits AtomicInt
+	// hotCache命中次数
+	hotCacheHits AtomicInt
+	// 缓存未命中需要加载的次数
+	loads AtomicInt
+	// singleflight去重后实际加载的次数
+	loadsDeduped AtomicInt
+	// 从远程节点加载成功次数
+	peerLoads AtomicInt
+	// 从远程节点加载失败次数
+	peerErrors AtomicInt
+	// 从本地加载成功次数
+	localLoads AtomicInt
+	// 从本地加载失败次数
+	localLoadErrs AtomicInt
+}
+
+// Stats Group的统计信息
+type Stats struct {
+	Gets          int64
+	MainCacheHits int64
+	HotCacheHits  int64
+	Loads         int64
+	LoadsDeduped  int64
+	PeerLoads     int64
+	PeerErrors    int64
+	LocalLoads    int64
+	LocalLoadErrs int64
+	// 以下为mainCache和hotCache之和
+	Evictions int64
+	Bytes     int64
+	Items     int64
+}
+
+// CacheType 缓存类型
+type CacheType int
+
+const (
+	// MainCache 本节点负责的key的缓存
+	MainCache CacheType = iota + 1
+	// HotCache 远程节点热点key的缓存
+	HotCache
+)
+
+// CacheStats 缓存的统计信息
+type CacheStats struct {
+	Gets      int64
+	Hits      int64
+	Evictions int64
+	Bytes     int64
+	Items     int64
+}
+
+// Stats 获取Group的统计信息
+func (g *Group) Stats() Stats {
+	main, hot := g.CacheStats(MainCache), g.CacheStats(HotCache)
+	return Stats{
+		Gets:          g.stats.gets.Get(),
+		MainCacheHits: g.stats.mainCacheHits.Get(),
+		HotCacheHits:  g.stats.hotCacheHits.Get(),
+		Loads:         g.stats.loads.Get(),
+		LoadsDeduped:  g.stats.loadsDeduped.Get(),
+		PeerLoads:     g.stats.peerLoads.Get(),
+		PeerErrors:    g.stats.peerErrors.Get(),
+		LocalLoads:    g.stats.localLoads.Get(),
+		LocalLoadErrs: g.stats.localLoadErrs.Get(),
+		Evictions:     main.Evictions + hot.Evictions,
+		Bytes:         main.Bytes + hot.Bytes,
+		Items:         main.Items + hot.Items,
+	}
+}
+
+// CacheStats 获取缓存的统计信息，hotCache没有设置时返回零值
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		if g.hotCache == nil {
+			return CacheStats{}
+		}
+		return g.hotCache.stats()
+	default:
+		panic("unknown cache type " + strconv.Itoa(int(which)))
+	}
+}
@@ -0,0 +1,89 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroup_Stats(t *testing.T) {
+	g := NewGroup("stats", 20, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		if key == "bad" {
+			return ByteView{}, errors.New("bad key")
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	ctx := context.Background()
+	g.GetContext(ctx, "a")
+	g.GetContext(ctx, "a")
+	g.GetContext(ctx, "bad")
+	g.GetManyContext(ctx, []string{"a", "b", "c"})
+	stats := g.Stats()
+	want := Stats{
+		Gets:          6,
+		MainCacheHits: 2,
+		Loads:         4,
+		LoadsDeduped:  4,
+		LocalLoads:    3,
+		LocalLoadErrs: 1,
+		Bytes:         6,
+		Items:         3,
+	}
+	if stats != want {
+		t.Fatalf("stats=%+v, want %+v", stats, want)
+	}
+
+	// 超过最大字节数时淘汰
+	for i := 0; i < 10; i++ {
+		g.GetContext(ctx, "key"+strconv.Itoa(i))
+	}
+	main := g.CacheStats(MainCache)
+	if main.Evictions == 0 || main.Bytes > 20 || main.Gets != 16 || main.Hits != 2 {
+		t.Fatalf("main cache stats=%+v", main)
+	}
+	// 主动删除不算淘汰
+	g.removeLocally("key9")
+	if evictions := g.CacheStats(MainCache).Evictions; evictions != main.Evictions {
+		t.Fatalf("remove counted as eviction, %d != %d", evictions, main.Evictions)
+	}
+	if hot := g.CacheStats(HotCache); hot != (CacheStats{}) {
+		t.Fatalf("hot cache stats=%+v, want zero", hot)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	g := NewGroup("metrics\"", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}), WithHotCache(1<<10))
+	g.GetContext(context.Background(), "a")
+	g.GetContext(context.Background(), "a")
+
+	srv := httptest.NewServer(MetricsHandler())
+	defer srv.Close()
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE gcache_gets_total counter",
+		`gcache_gets_total{group="metrics\""} 2`,
+		`gcache_main_cache_hits_total{group="metrics\""} 1`,
+		"# TYPE gcache_cache_bytes gauge",
+		`gcache_cache_bytes{group="metrics\"",cache="main"} 2`,
+		`gcache_cache_items{group="metrics\"",cache="hot"} 0`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("metrics missing %q:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package gcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/jiaxwu/gcache/gcachepb"
+)
+
+// 自定义TCP协议，每个帧的格式为：
+// | length uint32 | id uint64 | op uint8 | timeout uint32 | payload |
+// length是length之后所有字节的长度，id用于在同一个连接上匹配请求和响应，
+// 请求帧的op为操作类型，timeout为剩余超时时间（毫秒，0表示没有超时），
+// 响应帧的op为响应状态，payload是protobuf编码的gcachepb消息，错误响应的payload是错误信息
+
+const (
+	// 帧头长度，不包括length
+	tcpHeaderLen = 8 + 1 + 4
+	// 最大帧长度，避免异常数据导致分配过多内存
+	tcpMaxFrameLen = 64 << 20
+	// 每个远程节点的默认连接数
+	defaultTCPConns = 4
+	// 建立连接的超时时间
+	tcpDialTimeout = 5 * time.Second
+	// 写入一个帧的默认超时时间，避免对端不读取时一直阻塞
+	tcpWriteTimeout = 5 * time.Second
+)
+
+// ErrTCPPoolClosed TCPPool关闭后Serve返回的错误
+var ErrTCPPoolClosed = errors.New("gcache: tcp pool closed")
+
+// 请求操作类型
+const (
+	tcpOpGet uint8 = iota + 1
+	tcpOpRemove
+	tcpOpSet
+	tcpOpGetMany
+	// 取消之前发送的请求，没有响应
+	tcpOpCancel
+)
+
+// 响应状态
+const (
+	tcpStatusOK uint8 = iota
+	tcpStatusError
+)
+
+// 一个协议帧
+type tcpFrame struct {
+	id      uint64
+	op      uint8
+	timeout uint32
+	payload []byte
+}
+
+func writeTCPFrame(w io.Writer, f tcpFrame) error {
+	var header [4 + tcpHeaderLen]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(tcpHeaderLen+len(f.payload)))
+	binary.BigEndian.PutUint64(header[4:12], f.id)
+	header[12] = f.op
+	binary.BigEndian.PutUint32(header[13:17], f.timeout)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.payload)
+	return err
+}
+
+func readTCPFrame(r io.Reader) (tcpFrame, error) {
+	var header [4 + tcpHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return tcpFrame{}, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < tcpHeaderLen || length > tcpMaxFrameLen {
+		return tcpFrame{}, fmt.Errorf("bad frame length: %d", length)
+	}
+	f := tcpFrame{
+		id:      binary.BigEndian.Uint64(header[4:12]),
+		op:      header[12],
+		timeout: binary.BigEndian.Uint32(header[13:17]),
+		payload: make([]byte, length-tcpHeaderLen),
+	}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return tcpFrame{}, err
+	}
+	return f, nil
+}
+
+// TCPPool 基于自定义TCP协议实现的伙伴节点
+type TCPPool struct {
+	// 同伴节点，self为监听地址，比如example.net:8080
+	peerSet
+	// 每个远程节点的连接数
+	conns int
+	// 写入一个帧的超时时间
+	writeTimeout time.Duration
+
+	// 服务端正在监听的listener和正在处理的连接，Close时关闭
+	serveMu   sync.Mutex
+	listeners map[net.Listener]struct{}
+	serving   map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewTCPPool 创建一个TCPPool
+func NewTCPPool(self string) *TCPPool {
+	p := &TCPPool{
+		conns:        defaultTCPConns,
+		writeTimeout: tcpWriteTimeout,
+		listeners:    make(map[net.Listener]struct{}),
+		serving:      make(map[net.Conn]struct{}),
+	}
+	p.self = self
+	p.newGetter = func(peer string) PeerGetter {
+		return &tcpGetter{addr: peer, conns: make([]*tcpConn, p.conns), writeTimeout: p.writeTimeout}
+	}
+	return p
+}
+
+// SetConns 设置每个远程节点的连接数，需要在设置同伴节点之前调用
+func (p *TCPPool) SetConns(conns int) {
+	if conns <= 0 {
+		panic("conns must be greater than 0")
+	}
+	p.conns = conns
+}
+
+// ListenAndServe 监听addr并处理请求
+func (p *TCPPool) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(lis)
+}
+
+// Serve 处理lis上的所有连接，直到lis被关闭
+// 调用Close后返回ErrTCPPoolClosed
+func (p *TCPPool) Serve(lis net.Listener) error {
+	p.serveMu.Lock()
+	if p.closed {
+		p.serveMu.Unlock()
+		lis.Close()
+		return ErrTCPPoolClosed
+	}
+	p.listeners[lis] = struct{}{}
+	p.serveMu.Unlock()
+	defer func() {
+		p.serveMu.Lock()
+		delete(p.listeners, lis)
+		p.serveMu.Unlock()
+	}()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			p.serveMu.Lock()
+			closed := p.closed
+			p.serveMu.Unlock()
+			if closed {
+				return ErrTCPPoolClosed
+			}
+			return err
+		}
+		p.serveMu.Lock()
+		if p.closed {
+			p.serveMu.Unlock()
+			conn.Close()
+			return ErrTCPPoolClosed
+		}
+		p.serving[conn] = struct{}{}
+		p.serveMu.Unlock()
+		go p.serveConn(conn)
+	}
+}
+
+// Close 停止所有Serve并关闭正在处理的连接，不影响请求其他节点的连接
+func (p *TCPPool) Close() error {
+	p.serveMu.Lock()
+	defer p.serveMu.Unlock()
+	p.closed = true
+	var err error
+	for lis := range p.listeners {
+		if closeErr := lis.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(p.listeners, lis)
+	}
+	for conn := range p.serving {
+		conn.Close()
+		delete(p.serving, conn)
+	}
+	return err
+}
+
+// 处理一个连接，请求并发处理，响应按照完成顺序返回
+func (p *TCPPool) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		p.serveMu.Lock()
+		delete(p.serving, conn)
+		p.serveMu.Unlock()
+	}()
+	var (
+		wmu    sync.Mutex
+		w      = bufio.NewWriter(conn)
+		broken bool
+		// 正在处理的请求，用于取消
+		mu      sync.Mutex
+		cancels = make(map[uint64]context.CancelFunc)
+	)
+	cancelAll := func() {
+		mu.Lock()
+		for _, cancel := range cancels {
+			cancel()
+		}
+		mu.Unlock()
+	}
+	defer cancelAll()
+	// 写入响应，对端不读取时超时
+	// 写入失败后连接上可能有不完整的帧，关闭连接并取消所有正在处理的请求
+	write := func(res tcpFrame) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		if broken {
+			return
+		}
+		err := conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+		if err == nil {
+			err = writeTCPFrame(w, res)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			broken = true
+			p.log().Warn("write tcp frame failed", "server", p.self, "err", err)
+			conn.Close()
+			cancelAll()
+		}
+	}
+	r := bufio.NewReader(conn)
+	for {
+		req, err := readTCPFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				p.log().Warn("read tcp frame failed", "server", p.self, "err", err)
+			}
+			return
+		}
+		if req.op == tcpOpCancel {
+			mu.Lock()
+			if cancel, ok := cancels[req.id]; ok {
+				cancel()
+			}
+			mu.Unlock()
+			continue
+		}
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if req.timeout != 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), time.Duration(req.timeout)*time.Millisecond)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+		}
+		mu.Lock()
+		cancels[req.id] = cancel
+		mu.Unlock()
+		go func(req tcpFrame) {
+			res := p.handle(ctx, req)
+			mu.Lock()
+			delete(cancels, req.id)
+			mu.Unlock()
+			cancel()
+			write(res)
+		}(req)
+	}
+}
+
+// 处理一个请求
+func (p *TCPPool) handle(ctx context.Context, req tcpFrame) tcpFrame {
+	out, err := p.handleOp(ctx, req.op, req.payload)
+	if err != nil {
+		return tcpFrame{id: req.id, op: tcpStatusError, payload: []byte(err.Error())}
+	}
+	var payload []byte
+	if out != nil {
+		if payload, err = proto.Marshal(out); err != nil {
+			return tcpFrame{id: req.id, op: tcpStatusError, payload: []byte(err.Error())}
+		}
+	}
+	return tcpFrame{id: req.id, op: tcpStatusOK, payload: payload}
+}
+
+func (p *TCPPool) handleOp(ctx context.Context, op uint8, payload []byte) (proto.Message, error) {
+	switch op {
+	case tcpOpGet, tcpOpRemove:
+		var in pb.Request
+		if err := proto.Unmarshal(payload, &in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, errors.New("no such group: " + in.Group)
+		}
+		if op == tcpOpRemove {
+			group.removeLocally(in.Key)
+			return nil, nil
+		}
+		res, err := group.serveGet(ctx, in.Key)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case tcpOpSet:
+		var in pb.SetRequest
+		if err := proto.Unmarshal(payload, &in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, errors.New("no such group: " + in.Group)
+		}
+		group.setLocally(in.Key, NewByteView(in.Value, fromExpireNano(in.Expire)))
+		return nil, nil
+	case tcpOpGetMany:
+		var in pb.BatchRequest
+		if err := proto.Unmarshal(payload, &in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, errors.New("no such group: " + in.Group)
+		}
+		res, err := group.serveGetMany(ctx, in.Keys)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unknown op: %d", op)
+	}
+}
+
+// 远程节点请求客户端，每个远程节点一个，持有少量长连接
+type tcpGetter struct {
+	addr         string
+	writeTimeout time.Duration
+	// 轮询选择连接
+	next   uint32
+	mu     sync.Mutex
+	conns  []*tcpConn
+	closed bool
+}
+
+func (g *tcpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *tcpGetter) Remove(in *pb.Request) error {
+	return g.RemoveContext(context.Background(), in)
+}
+
+func (g *tcpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.call(ctx, tcpOpGet, in, out)
+}
+
+func (g *tcpGetter) RemoveContext(ctx context.Context, in *pb.Request) error {
+	return g.call(ctx, tcpOpRemove, in, nil)
+}
+
+func (g *tcpGetter) SetContext(ctx context.Context, in *pb.SetRequest) error {
+	return g.call(ctx, tcpOpSet, in, nil)
+}
+
+func (g *tcpGetter) GetManyContext(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return g.call(ctx, tcpOpGetMany, in, out)
+}
+
+// Close 关闭所有连接
+func (g *tcpGetter) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for i, conn := range g.conns {
+		if conn != nil {
+			conn.close(errors.New("getter closed"))
+			g.conns[i] = nil
+		}
+	}
+	return nil
+}
+
+func (g *tcpGetter) call(ctx context.Context, op uint8, in, out proto.Message) error {
+	payload, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var timeout uint32
+	if deadline, ok := ctx.Deadline(); ok {
+		ms := time.Until(deadline).Milliseconds()
+		if ms <= 0 {
+			return context.DeadlineExceeded
+		}
+		if ms > math.MaxUint32 {
+			ms = math.MaxUint32
+		}
+		timeout = uint32(ms)
+	}
+	conn, err := g.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := conn.call(ctx, op, timeout, payload)
+	if err != nil {
+		return err
+	}
+	if res.op != tcpStatusOK {
+		return fmt.Errorf("server returned: %s", res.payload)
+	}
+	if out == nil {
+		return nil
+	}
+	return proto.Unmarshal(res.payload, out)
+}
+
+// 轮询获取一个可用连接，连接不可用时重新建立
+// 建立连接时不持有锁，避免阻塞使用其他连接的请求
+func (g *tcpGetter) getConn(ctx context.Context) (*tcpConn, error) {
+	i := int(atomic.AddUint32(&g.next, 1)) % len(g.conns)
+	g.mu.Lock()
+	if conn := g.conns[i]; conn != nil && !conn.broken() {
+		g.mu.Unlock()
+		return conn, nil
+	}
+	g.mu.Unlock()
+	dialer := net.Dialer{Timeout: tcpDialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", g.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := newTCPConn(nc, g.writeTimeout)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		conn.close(errors.New("getter closed"))
+		return nil, errors.New("getter closed")
+	}
+	// 其他请求已经重新建立了连接
+	if cur := g.conns[i]; cur != nil && !cur.broken() {
+		conn.close(errors.New("duplicate connection"))
+		return cur, nil
+	}
+	g.conns[i] = conn
+	return conn, nil
+}
+
+// 客户端连接，同一个连接上可以同时有多个请求
+type tcpConn struct {
+	conn net.Conn
+	// 保证帧写入的完整性
+	wmu sync.Mutex
+	w   *bufio.Writer
+	// 写入一个帧的超时时间
+	writeTimeout time.Duration
+	// 等待响应的请求
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan tcpFrame
+	err     error
+	done    chan struct{}
+}
+
+func newTCPConn(conn net.Conn, writeTimeout time.Duration) *tcpConn {
+	c := &tcpConn{
+		conn:         conn,
+		w:            bufio.NewWriter(conn),
+		writeTimeout: writeTimeout,
+		pending:      make(map[uint64]chan tcpFrame),
+		done:         make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// 发送请求并等待响应
+func (c *tcpConn) call(ctx context.Context, op uint8, timeout uint32, payload []byte) (tcpFrame, error) {
+	ch := make(chan tcpFrame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return tcpFrame{}, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	// 连接被多个请求共享，不能使用单个请求的截止时间写入，否则超时时写了一半的帧会导致其他请求失败
+	// 请求的截止时间在等待响应时处理
+	if err := c.write(tcpFrame{id: id, op: op, timeout: timeout, payload: payload}); err != nil {
+		c.close(err)
+		return tcpFrame{}, err
+	}
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-c.done:
+		return tcpFrame{}, c.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		// 通知远程节点停止处理
+		if err := c.write(tcpFrame{id: id, op: tcpOpCancel}); err != nil {
+			c.close(err)
+		}
+		return tcpFrame{}, ctx.Err()
+	}
+}
+
+// 写入一个帧，writeTimeout之内没有写完时返回错误
+// 写入失败时连接上可能有不完整的帧，调用方需要关闭连接
+func (c *tcpConn) write(f tcpFrame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		return err
+	}
+	if err := writeTCPFrame(c.w, f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// 读取响应并分发给对应的请求
+func (c *tcpConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		res, err := readTCPFrame(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[res.id]
+		delete(c.pending, res.id)
+		c.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+}
+
+// 关闭连接，所有等待中的请求返回err
+func (c *tcpConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.pending = nil
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *tcpConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
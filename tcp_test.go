@@ -0,0 +1,319 @@
+package gcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/jiaxwu/gcache/gcachepb"
+)
+
+// 启动TCP服务器，返回连接它的TCPPool
+func newTCPTestPool(t testing.TB) *TCPPool {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(lis.Addr().String())
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Close() })
+
+	pool := NewTCPPool("self")
+	pool.Set(lis.Addr().String())
+	t.Cleanup(func() { pool.Set() })
+	return pool
+}
+
+func TestTCPFrame(t *testing.T) {
+	var buf bytes.Buffer
+	f := tcpFrame{id: 42, op: tcpOpGetMany, timeout: 100, payload: []byte("payload")}
+	if err := writeTCPFrame(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTCPFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.id != f.id || got.op != f.op || got.timeout != f.timeout || string(got.payload) != string(f.payload) {
+		t.Fatalf("expect frame %+v but %+v", f, got)
+	}
+}
+
+func TestTCPPool(t *testing.T) {
+	g := NewGroup("tcp", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		switch key {
+		case "unknown":
+			return ByteView{}, errors.New("not found")
+		case "missing":
+			return ByteView{}, ErrNotFound
+		}
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	pool := newTCPTestPool(t)
+	peer, ok := pool.PickPeer("key")
+	if !ok {
+		t.Fatalf("key should belong to remote peer")
+	}
+	ctx := context.Background()
+
+	var res pb.Response
+	if err := peer.GetContext(ctx, &pb.Request{Group: "tcp", Key: "key"}, &res); err != nil || string(res.Value) != "key" {
+		t.Fatalf("get over tcp failed, value=%s err=%v", res.Value, err)
+	}
+	if err := peer.GetContext(ctx, &pb.Request{Group: "tcp", Key: "unknown"}, &res); err == nil {
+		t.Fatalf("get unknown key should fail")
+	}
+	if err := peer.SetContext(ctx, &pb.SetRequest{Group: "tcp", Key: "key", Value: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	if view, ok := g.mainCache.get("key"); !ok || view.String() != "new" {
+		t.Fatalf("set over tcp failed, value=%s", view)
+	}
+	if err := peer.RemoveContext(ctx, &pb.Request{Group: "tcp", Key: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("key"); ok {
+		t.Fatalf("remove over tcp failed")
+	}
+	var batch pb.BatchResponse
+	if err := peer.GetManyContext(ctx, &pb.BatchRequest{Group: "tcp", Keys: []string{"k1", "k2", "unknown", "missing"}}, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Values) != 3 || string(batch.Values["k1"].Value) != "k1" {
+		t.Fatalf("get many over tcp failed, values=%v", batch.Values)
+	}
+	// 不存在的key返回NotFound
+	if res := batch.Values["missing"]; !res.GetNotFound() || res.GetExpire() != 0 {
+		t.Fatalf("missing key over tcp, response=%v", res)
+	}
+
+	// 多个请求在同一个连接上并发
+	pool.SetConns(1)
+	pool.Set(pool.peers.Get("key"))
+	peer, _ = pool.PickPeer("key")
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			var res pb.Response
+			if err := peer.GetContext(ctx, &pb.Request{Group: "tcp", Key: key}, &res); err != nil || string(res.Value) != key {
+				t.Errorf("pipelined get %s failed, value=%s err=%v", key, res.Value, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+func TestTCPPool_Cancel(t *testing.T) {
+	loaded := make(chan error, 1)
+	NewGroup("tcp-cancel", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		<-ctx.Done()
+		loaded <- nil
+		return ByteView{}, ctx.Err()
+	}))
+	pool := newTCPTestPool(t)
+	peer, _ := pool.PickPeer("key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := peer.GetContext(ctx, &pb.Request{Group: "tcp-cancel", Key: "key"}, &pb.Response{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("get should be canceled, err=%v", err)
+	}
+	select {
+	case <-loaded:
+	case <-time.After(time.Second):
+		t.Fatalf("peer kept loading after caller gave up")
+	}
+}
+
+func TestTCPPool_Close(t *testing.T) {
+	NewGroup("tcp-close", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(lis.Addr().String())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(lis) }()
+
+	getter := &tcpGetter{addr: lis.Addr().String(), conns: make([]*tcpConn, 1), writeTimeout: tcpWriteTimeout}
+	defer getter.Close()
+	ctx := context.Background()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "tcp-close", Key: "key"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	conn := getter.conns[0]
+
+	// 关闭后Serve返回，已经建立的连接也被关闭
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if err != ErrTCPPoolClosed {
+			t.Fatalf("serve err=%v, want ErrTCPPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("serve not stopped after close")
+	}
+	select {
+	case <-conn.done:
+	case <-time.After(time.Second):
+		t.Fatalf("serving connection not closed")
+	}
+	if err := getter.GetContext(ctx, &pb.Request{Group: "tcp-close", Key: "key"}, &pb.Response{}); err == nil {
+		t.Fatalf("get should fail after server closed")
+	}
+	if err := server.Serve(lis); err != ErrTCPPoolClosed {
+		t.Fatalf("serve after close err=%v", err)
+	}
+}
+
+func TestTCPConn_WriteDeadline(t *testing.T) {
+	// 只建立连接不读取数据的对端
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			defer conn.Close()
+			<-stop
+		}
+	}()
+
+	nc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTCPConn(nc, 200*time.Millisecond)
+	defer conn.close(errors.New("test done"))
+	// 超过socket缓冲区大小，写入会阻塞
+	start := time.Now()
+	if _, err := conn.call(context.Background(), tcpOpSet, 0, make([]byte, 32<<20)); err == nil {
+		t.Fatalf("call should fail when peer does not read")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("write blocked for %v after write timeout", d)
+	}
+	if !conn.broken() {
+		t.Fatalf("connection with partial frame should be closed")
+	}
+}
+
+func TestTCPConn_ShortDeadline(t *testing.T) {
+	NewGroup("tcp-short-deadline", 2<<30, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(lis.Addr().String())
+	go server.Serve(lis)
+	defer server.Close()
+	nc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTCPConn(nc, tcpWriteTimeout)
+	defer conn.close(errors.New("test done"))
+
+	// 写入大帧时请求超时，不能影响同一个连接上的其他请求
+	payload, _ := proto.Marshal(&pb.SetRequest{Group: "tcp-short-deadline", Key: "big", Value: make([]byte, 32<<20)})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := conn.call(ctx, tcpOpSet, 1, payload); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call err=%v, want deadline exceeded", err)
+	}
+	if conn.broken() {
+		t.Fatalf("connection closed by a request deadline")
+	}
+	payload, _ = proto.Marshal(&pb.Request{Group: "tcp-short-deadline", Key: "key"})
+	res, err := conn.call(context.Background(), tcpOpGet, 0, payload)
+	if err != nil || res.op != tcpStatusOK {
+		t.Fatalf("call after short deadline res=%+v err=%v", res, err)
+	}
+}
+
+func TestTCPPool_ServeWriteTimeout(t *testing.T) {
+	NewGroup("tcp-write-timeout", 2<<30, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView(make([]byte, 1<<20), time.Time{}), nil
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(lis.Addr().String())
+	server.writeTimeout = 100 * time.Millisecond
+	go server.Serve(lis)
+	defer server.Close()
+
+	// 发送请求但不读取响应的客户端
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 64; i++ {
+		payload, _ := proto.Marshal(&pb.Request{Group: "tcp-write-timeout", Key: strconv.Itoa(i)})
+		if err := writeTCPFrame(conn, tcpFrame{id: uint64(i + 1), op: tcpOpGet, payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 写入超时后服务端关闭连接
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.serveMu.Lock()
+		n := len(server.serving)
+		server.serveMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection not closed after write timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func benchmarkPeerGet(b *testing.B, peer PeerGetter, group string) {
+	NewGroup(group, 2<<20, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+		return NewByteView([]byte(key), time.Time{}), nil
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		for i := 0; p.Next(); i++ {
+			if err := peer.GetContext(context.Background(), &pb.Request{Group: group, Key: strconv.Itoa(i % 1000)}, &pb.Response{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkTCPPool_Get(b *testing.B) {
+	pool := newTCPTestPool(b)
+	peer, _ := pool.PickPeer("key")
+	benchmarkPeerGet(b, peer, "bench-tcp")
+}
+
+func BenchmarkHTTPPool_Get(b *testing.B) {
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+	benchmarkPeerGet(b, &httpGetter{baseURL: srv.URL + defaultBasePath}, "bench-http")
+}
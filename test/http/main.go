@@ -15,12 +15,13 @@ var db = map[string]string{
 }
 
 func main() {
+	gcache.SetLogger(gcache.NewStdLogger(log.Default(), gcache.LevelDebug))
 	gcache.NewGroup("scores", 2<<10, gcache.GetterFunc(func(key string) (gcache.ByteView, error) {
 		log.Println("[SlowDB] search key", key)
 		if v, ok := db[key]; ok {
 			return gcache.NewByteView([]byte(v), time.Time{}), nil
 		}
-		return gcache.ByteView{}, fmt.Errorf("%s does not exist", key)
+		return gcache.ByteView{}, fmt.Errorf("%s does not exist: %w", key, gcache.ErrNotFound)
 	}))
 	addr := "localhost:9999"
 	peers := gcache.NewHTTPPool(addr)
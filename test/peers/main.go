@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/jiaxwu/gcache"
@@ -22,6 +23,7 @@ var addrMap = map[int]string{
 }
 
 func main() {
+	gcache.SetLogger(gcache.NewStdLogger(log.Default(), gcache.LevelDebug))
 	// 命令行参数解析
 	var (
 		port int
@@ -33,13 +35,17 @@ func main() {
 	flag.Parse()
 
 	// 创建本地group
-	g := gcache.NewGroup("scores", 2<<10, gcache.GetterFunc(func(key string) (gcache.ByteView, error) {
+	g := gcache.NewGroup("scores", 2<<10, gcache.ContextGetterFunc(func(ctx context.Context, key string) (gcache.ByteView, error) {
 		log.Println("[SlowDB] search key", key)
-		time.Sleep(time.Second)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return gcache.ByteView{}, ctx.Err()
+		}
 		if v, ok := db[key]; ok {
 			return gcache.NewByteView([]byte(v), time.Now().Add(time.Minute)), nil
 		}
-		return gcache.ByteView{}, fmt.Errorf("%s does not exist", key)
+		return gcache.ByteView{}, fmt.Errorf("%s does not exist: %w", key, gcache.ErrNotFound)
 	}))
 	g.SetHotCache(2 << 9)
 	g.SetEmptyWhenError(time.Minute)
@@ -51,7 +57,7 @@ func main() {
 			apiServerAddr := "localhost:9999"
 			http.Handle("/api", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				key := r.URL.Query().Get("key")
-				view, err := g.Get(key)
+				view, err := g.GetContext(r.Context(), key)
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
@@ -61,7 +67,7 @@ func main() {
 			}))
 			http.Handle("/remove", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				key := r.URL.Query().Get("key")
-				err := g.Remove(key)
+				err := g.RemoveContext(r.Context(), key)
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
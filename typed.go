@@ -0,0 +1,97 @@
+package gcache
+
+import (
+	"context"
+	"time"
+)
+
+// TypedGetter 用于加载V类型的数据，同时返回过期时间，零值表示永不过期
+type TypedGetter[V any] interface {
+	Get(ctx context.Context, key string) (V, time.Time, error)
+}
+
+type TypedGetterFunc[V any] func(ctx context.Context, key string) (V, time.Time, error)
+
+func (f TypedGetterFunc[V]) Get(ctx context.Context, key string) (V, time.Time, error) {
+	return f(ctx, key)
+}
+
+// TypedGroup 存储V类型数据的Group
+// 数据在缓存和伙伴节点之间仍然以codec编码后的字节数组传输
+type TypedGroup[V any] struct {
+	*Group
+	codec Codec[V]
+}
+
+// NewTypedGroup 创建一个TypedGroup
+func NewTypedGroup[V any](name string, cacheBytes int, codec Codec[V], getter TypedGetter[V], opts ...GroupOption) *TypedGroup[V] {
+	if codec == nil {
+		panic("nil Codec")
+	}
+	if getter == nil {
+		panic("nil Getter")
+	}
+	return &TypedGroup[V]{
+		Group: NewGroup(name, cacheBytes, ContextGetterFunc(func(ctx context.Context, key string) (ByteView, error) {
+			v, expire, err := getter.Get(ctx, key)
+			if err != nil {
+				return ByteView{}, err
+			}
+			b, err := codec.Marshal(v)
+			if err != nil {
+				return ByteView{}, err
+			}
+			return NewByteView(b, expire), nil
+		}), opts...),
+		codec: codec,
+	}
+}
+
+// Get 从缓存获取key对应的value
+func (g *TypedGroup[V]) Get(key string) (V, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 同Get，参考Group.GetContext
+func (g *TypedGroup[V]) GetContext(ctx context.Context, key string) (V, error) {
+	view, err := g.Group.GetContext(ctx, key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return g.codec.Unmarshal(view.b)
+}
+
+// GetMany 批量从缓存获取keys对应的values，参考Group.GetMany
+func (g *TypedGroup[V]) GetMany(keys []string) (map[string]V, error) {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext 同GetMany，参考Group.GetManyContext
+func (g *TypedGroup[V]) GetManyContext(ctx context.Context, keys []string) (map[string]V, error) {
+	views, err := g.Group.GetManyContext(ctx, keys)
+	values := make(map[string]V, len(views))
+	for key, view := range views {
+		v, decodeErr := g.codec.Unmarshal(view.b)
+		if decodeErr != nil {
+			err = decodeErr
+			continue
+		}
+		values[key] = v
+	}
+	return values, err
+}
+
+// Set 设置key对应的value，expire为零值表示永不过期
+func (g *TypedGroup[V]) Set(key string, v V, expire time.Time) error {
+	return g.SetContext(context.Background(), key, v, expire)
+}
+
+// SetContext 同Set，参考Group.SetContext
+func (g *TypedGroup[V]) SetContext(ctx context.Context, key string, v V, expire time.Time) error {
+	b, err := g.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return g.Group.SetContext(ctx, key, NewByteView(b, expire))
+}
@@ -0,0 +1,62 @@
+package gcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/jiaxwu/gcache/gcachepb"
+)
+
+type score struct {
+	Name  string
+	Score int
+}
+
+func TestCodec(t *testing.T) {
+	want := score{Name: "Tom", Score: 630}
+	for name, codec := range map[string]Codec[score]{
+		"json": JSONCodec[score]{},
+		"gob":  GobCodec[score]{},
+	} {
+		b, err := codec.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s marshal failed: %v", name, err)
+		}
+		if got, err := codec.Unmarshal(b); err != nil || got != want {
+			t.Fatalf("%s codec expect %v but %v, err=%v", name, want, got, err)
+		}
+	}
+
+	var codec ProtoCodec[*pb.Request]
+	b, err := codec.Marshal(&pb.Request{Group: "scores", Key: "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := codec.Unmarshal(b); err != nil || got.Group != "scores" || got.Key != "Tom" {
+		t.Fatalf("proto codec unmarshal failed, got=%v err=%v", got, err)
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	loads := 0
+	g := NewTypedGroup[score]("typed", 2<<10, JSONCodec[score]{}, TypedGetterFunc[score](func(ctx context.Context, key string) (score, time.Time, error) {
+		loads++
+		return score{Name: key, Score: len(key)}, time.Time{}, nil
+	}))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if v, err := g.GetContext(ctx, "Tom"); err != nil || v != (score{Name: "Tom", Score: 3}) || loads != 1 {
+			t.Fatalf("typed get failed, value=%v err=%v loads=%d", v, err, loads)
+		}
+	}
+
+	want := score{Name: "Jack", Score: 589}
+	if err := g.SetContext(ctx, "Jack", want, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	values, err := g.GetManyContext(ctx, []string{"Tom", "Jack"})
+	if err != nil || len(values) != 2 || values["Jack"] != want || loads != 1 {
+		t.Fatalf("typed get many failed, values=%v err=%v loads=%d", values, err, loads)
+	}
+}